@@ -0,0 +1,88 @@
+package trapi
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//
+// Api matcher: finds the api of a request by method and <param> path template
+//
+
+type apiMatcherRoute struct {
+	api    *Api
+	re     *regexp.Regexp
+	params []string
+	static int
+}
+
+type apiMatcher struct {
+	routes []*apiMatcherRoute
+}
+
+// newApiMatcher returns the matcher of the apis. Apis declared in several versions match their
+// highest version, views from Parser.ForVersion match the others.
+func newApiMatcher(apis []*Api) *apiMatcher {
+	latest := make(map[string]*Api)
+	for _, api := range apis {
+		key := strings.ToLower(api.Method) + " " + api.Path
+		if l, ok := latest[key]; !ok || CompareVersions(api.Version, l.Version) > 0 {
+			latest[key] = api
+		}
+	}
+
+	ret := &apiMatcher{}
+	for _, api := range apis {
+		if latest[strings.ToLower(api.Method)+" "+api.Path] != api {
+			continue
+		}
+
+		r := &apiMatcherRoute{
+			api: api,
+		}
+
+		var pattern strings.Builder
+		pattern.WriteString("^")
+		last := 0
+		for _, loc := range reAPIAPIParams.FindAllStringSubmatchIndex(api.Path, -1) {
+			pattern.WriteString(regexp.QuoteMeta(api.Path[last:loc[0]]))
+			pattern.WriteString("([^/]+)")
+			r.params = append(r.params, api.Path[loc[2]:loc[3]])
+			r.static += loc[0] - last
+			last = loc[1]
+		}
+		pattern.WriteString(regexp.QuoteMeta(strings.TrimSuffix(api.Path[last:], "/")))
+		pattern.WriteString("/?$")
+		r.static += len(api.Path) - last
+		r.re = regexp.MustCompile(pattern.String())
+
+		ret.routes = append(ret.routes, r)
+	}
+
+	// paths with more static text have precedence over params
+	sort.SliceStable(ret.routes, func(i, j int) bool {
+		return ret.routes[i].static > ret.routes[j].static
+	})
+
+	return ret
+}
+
+// match returns the api for the method and path, and the values of the path params.
+func (m *apiMatcher) match(method string, path string) (*Api, map[string]string) {
+	for _, r := range m.routes {
+		if !strings.EqualFold(r.api.Method, method) {
+			continue
+		}
+		s := r.re.FindStringSubmatch(path)
+		if s == nil {
+			continue
+		}
+		params := make(map[string]string)
+		for i, pn := range r.params {
+			params[pn] = s[i+1]
+		}
+		return r.api, params
+	}
+	return nil, nil
+}
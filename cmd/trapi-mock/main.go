@@ -0,0 +1,59 @@
+// Command trapi-mock serves a mock of the apis documented in Go source files.
+//
+//	trapi-mock -addr :8080 -dir ./api -dir ./handlers
+//
+// The response status can be selected with the X-Mock-Status header or the __status
+// query param, and the content type with the X-Mock-Content-Type or Accept headers or the
+// __content_type query param.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/RangelReale/gocompar"
+	"github.com/RangelReale/trapi"
+)
+
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func main() {
+	var dirs, files, tags stringList
+	addr := flag.String("addr", ":8080", "listen address")
+	flag.Var(&dirs, "dir", "directory to parse (can be repeated)")
+	flag.Var(&files, "file", "file to parse (can be repeated)")
+	flag.Var(&tags, "tag", "only parse files with this @apiTag (can be repeated)")
+	flag.Parse()
+
+	if len(dirs) == 0 && len(files) == 0 {
+		dirs = append(dirs, ".")
+	}
+
+	p := trapi.NewParser(gocompar.NewParser())
+	for _, d := range dirs {
+		p.AddDir(d)
+	}
+	for _, f := range files {
+		p.AddFile(f)
+	}
+	p.AddTags(tags)
+
+	err := p.Parse()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Serving mock of %d apis on %s", len(p.Apis), *addr)
+	log.Fatal(http.ListenAndServe(*addr, trapi.NewMockServer(p)))
+}
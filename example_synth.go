@@ -0,0 +1,518 @@
+package trapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+//
+// Example synthesizer: builds representative examples from data types
+//
+
+const exampleSynthMaxDepth = 4
+
+const (
+	CONTENTTYPE_JSON      = "application/json"
+	CONTENTTYPE_XML       = "application/xml"
+	CONTENTTYPE_FORM      = "application/x-www-form-urlencoded"
+	CONTENTTYPE_MULTIPART = "multipart/form-data"
+)
+
+type ExampleSynthesizer struct {
+	parser    *Parser
+	validator *dataValidator
+	rand      *rand.Rand
+
+	// include fields that are not required (default true)
+	OptionalFields bool
+
+	// names of the synthesized strings not matching the pattern of their data type, only
+	// recorded if not nil
+	patternMisses map[string]bool
+}
+
+// NewExampleSynthesizer creates a synthesizer. A seed of 0 generates fixed values, other
+// seeds generate random (but reproducible) values.
+func NewExampleSynthesizer(parser *Parser, seed int64) *ExampleSynthesizer {
+	ret := &ExampleSynthesizer{
+		parser:         parser,
+		validator:      newDataValidator(parser, false),
+		OptionalFields: true,
+	}
+	if seed != 0 {
+		ret.rand = rand.New(rand.NewSource(seed))
+	}
+	return ret
+}
+
+// exampleObject keeps the field order of the data type when encoding.
+type exampleObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newExampleObject() *exampleObject {
+	return &exampleObject{
+		values: make(map[string]interface{}),
+	}
+}
+
+func (o *exampleObject) set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *exampleObject) remove(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+func (o *exampleObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		kb, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		vb, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(kb)
+		buf.WriteString(":")
+		buf.Write(vb)
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+func (s *ExampleSynthesizer) intn(n int) int {
+	if s.rand == nil {
+		return 0
+	}
+	return s.rand.Intn(n)
+}
+
+// Value returns a value that encodes to JSON following the data type.
+func (s *ExampleSynthesizer) Value(dt *ApiDataType) interface{} {
+	return s.value(dt, "")
+}
+
+func (s *ExampleSynthesizer) value(dt *ApiDataType, name string) interface{} {
+	return s.valueDepth(dt, name, 0)
+}
+
+func (s *ExampleSynthesizer) valueDepth(dt *ApiDataType, name string, depth int) interface{} {
+	dt = s.validator.resolve(dt)
+	if dt == nil {
+		return nil
+	}
+
+	if len(dt.Enum) > 0 {
+		return s.enumValue(dt)
+	}
+
+	switch dt.DataType {
+	case DATATYPE_STRING:
+		return s.constrainedString(dt, name)
+	case DATATYPE_NUMBER:
+		return s.constrainedNumber(dt, 1.5+float64(s.intn(1000)))
+	case DATATYPE_INTEGER:
+		return int(s.constrainedNumber(dt, float64(1+s.intn(1000))))
+	case DATATYPE_BOOLEAN:
+		return s.intn(2) == 0
+	case DATATYPE_BINARY:
+		return "U2FtcGxlIGJpbmFyeSBkYXRh"
+	case DATATYPE_DATE:
+		return s.timeValue().Format(DATE_FORMAT)
+	case DATATYPE_TIME:
+		return s.timeValue().Format(TIME_FORMAT)
+	case DATATYPE_DATETIME:
+		return s.timeValue().Format(DATETIME_FORMAT)
+	case DATATYPE_UNION:
+		i := s.intn(len(dt.OneOf))
+		m := dt.OneOf[i]
+		ret := s.valueDepth(dt.OneOfTypes[i], name, depth+1)
+		if o, ok := ret.(*exampleObject); ok && dt.Discriminator != nil {
+			o.set(dt.Discriminator.Field, dt.Discriminator.Value(m))
+		}
+		return ret
+	case DATATYPE_MAP:
+		ret := newExampleObject()
+		if depth < exampleSynthMaxDepth && dt.KeyDataType != nil && dt.ValueDataType != nil {
+			key := fmt.Sprint(s.valueDepth(dt.KeyDataType, "key", depth+1))
+			ret.set(key, s.valueDepth(dt.ValueDataType, name, depth+1))
+		}
+		return ret
+	case DATATYPE_ARRAY:
+		ret := make([]interface{}, 0)
+		if it := s.validator.itemType(dt); it != nil && depth < exampleSynthMaxDepth {
+			count := 1
+			if dt.MinItems != nil && *dt.MinItems > count {
+				count = *dt.MinItems
+			}
+			if dt.MaxItems != nil && *dt.MaxItems < count {
+				count = *dt.MaxItems
+			}
+			for i := 0; i < count; i++ {
+				ret = append(ret, s.valueDepth(it, name, depth+1))
+			}
+		}
+		return ret
+	case DATATYPE_OBJECT:
+		ret := newExampleObject()
+		if depth < exampleSynthMaxDepth {
+			example := s.objectExample(dt)
+			for _, fn := range dt.ItemsOrder {
+				field := dt.Items[fn]
+				if !field.Required && !s.OptionalFields {
+					continue
+				}
+				// patterns are followed using the example of the object or the default value
+				if fdt := s.validator.resolve(field.ApiDataType); fdt != nil && fdt.DataType == DATATYPE_STRING && fdt.Pattern != "" && len(fdt.Enum) == 0 {
+					var candidates []string
+					if ev, ok := example[fn].(string); ok {
+						candidates = append(candidates, ev)
+					}
+					if field.Default != nil {
+						candidates = append(candidates, *field.Default)
+					}
+					ret.set(fn, s.constrainedString(fdt, fn, candidates...))
+					continue
+				}
+				ret.set(fn, s.valueDepth(field.ApiDataType, fn, depth+1))
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
+// enumValue returns one of the allowed values, with the type of the data type.
+func (s *ExampleSynthesizer) enumValue(dt *ApiDataType) interface{} {
+	ev := dt.Enum[s.intn(len(dt.Enum))].Value
+	switch dt.DataType {
+	case DATATYPE_INTEGER:
+		if i, err := strconv.ParseInt(ev, 10, 64); err == nil {
+			return i
+		}
+	case DATATYPE_NUMBER:
+		if f, err := strconv.ParseFloat(ev, 64); err == nil {
+			return f
+		}
+	case DATATYPE_BOOLEAN:
+		if b, err := strconv.ParseBool(ev); err == nil {
+			return b
+		}
+	}
+	return ev
+}
+
+func (s *ExampleSynthesizer) timeValue() time.Time {
+	return time.Date(2020, time.January, 15, 10, 30, 0, 0, time.UTC).Add(time.Duration(s.intn(365*24)) * time.Hour)
+}
+
+// constrainedNumber moves the value into the minimum and maximum of the data type.
+func (s *ExampleSynthesizer) constrainedNumber(dt *ApiDataType, value float64) float64 {
+	if dt.Minimum != nil && dt.Maximum != nil {
+		span := *dt.Maximum - *dt.Minimum
+		if dt.DataType == DATATYPE_INTEGER && span < 1000 {
+			return *dt.Minimum + float64(s.intn(int(span)+1))
+		}
+		return *dt.Minimum + math.Min(span, value)
+	}
+	if dt.Minimum != nil && value < *dt.Minimum {
+		return *dt.Minimum + value
+	}
+	if dt.Maximum != nil && value > *dt.Maximum {
+		return *dt.Maximum - float64(s.intn(10))
+	}
+	return value
+}
+
+// constrainedString returns a string following the format and length of the data type.
+// Values are not generated from patterns, the candidates and examples of the data type are
+// used instead, and misses are recorded.
+func (s *ExampleSynthesizer) constrainedString(dt *ApiDataType, name string, candidates ...string) string {
+	var ret string
+	switch dt.Format {
+	case "email":
+		ret = s.stringValue("email")
+	case "uuid":
+		ret = s.stringValue("uuid")
+	case "uri", "url":
+		ret = s.stringValue("url")
+	case "ipv4":
+		ret = fmt.Sprintf("192.0.2.%d", 1+s.intn(254))
+	case "ipv6":
+		ret = fmt.Sprintf("2001:db8::%x", 1+s.intn(0xffff))
+	default:
+		ret = s.stringValue(name)
+	}
+
+	if dt.MinLength != nil {
+		for utf8.RuneCountInString(ret) < *dt.MinLength {
+			ret += "x"
+		}
+	}
+	if dt.MaxLength != nil && utf8.RuneCountInString(ret) > *dt.MaxLength {
+		ret = string([]rune(ret)[:*dt.MaxLength])
+	}
+
+	if dt.Pattern != "" {
+		re := dt.PatternRegexp
+		if re == nil {
+			re = regexp.MustCompile(dt.Pattern)
+		}
+		if re.MatchString(ret) {
+			return ret
+		}
+		for _, ex := range dt.Examples {
+			var ev string
+			if !isJSONContentType(ex.ContentType) || json.Unmarshal([]byte(ex.Text), &ev) != nil {
+				ev = strings.TrimSpace(ex.Text)
+			}
+			candidates = append(candidates, ev)
+		}
+		for _, c := range candidates {
+			if re.MatchString(c) {
+				return c
+			}
+		}
+		if s.patternMisses != nil {
+			s.patternMisses[name] = true
+		}
+	}
+	return ret
+}
+
+// objectExample returns the first json example of an object, or nil.
+func (s *ExampleSynthesizer) objectExample(dt *ApiDataType) map[string]interface{} {
+	for _, ex := range dt.Examples {
+		if !isJSONContentType(ex.ContentType) {
+			continue
+		}
+		var ret map[string]interface{}
+		if json.Unmarshal([]byte(ex.Text), &ret) == nil {
+			return ret
+		}
+	}
+	return nil
+}
+
+// stringValue returns a string based on the field name.
+func (s *ExampleSynthesizer) stringValue(name string) string {
+	lname := strings.ToLower(name)
+	if pos := strings.LastIndexAny(lname, ".["); pos >= 0 {
+		lname = lname[pos+1:]
+	}
+	switch {
+	case strings.Contains(lname, "email"):
+		return fmt.Sprintf("user%d@example.com", 1+s.intn(100))
+	case strings.Contains(lname, "url") || strings.Contains(lname, "link"):
+		return "https://example.com/"
+	case strings.Contains(lname, "uuid") || strings.Contains(lname, "guid"):
+		return fmt.Sprintf("3f2504e0-4f89-11d3-9a0c-%012x", 0x0305e82c3301+s.intn(1000))
+	case strings.Contains(lname, "phone"):
+		return "+1-555-0100"
+	case lname == "":
+		return "string"
+	}
+	if s.rand != nil {
+		return fmt.Sprintf("%s%d", lname, s.intn(1000))
+	}
+	return lname
+}
+
+// Synthesize builds an example of the data type encoded as JSON, XML or form.
+func (s *ExampleSynthesizer) Synthesize(dt *ApiDataType, contenttype string) (*ApiExample, error) {
+	value := s.Value(dt)
+
+	var text string
+	switch {
+	case isJSONContentType(contenttype):
+		b, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	case isXMLContentType(contenttype):
+		root := "root"
+		if dt != nil && dt.DataTypeName != "" && !dt.BuiltIn {
+			root = dt.DataTypeName
+		}
+		var buf bytes.Buffer
+		err := writeExampleXML(&buf, root, value, "")
+		if err != nil {
+			return nil, err
+		}
+		text = strings.TrimSuffix(buf.String(), "\n")
+	case sameMediaType(contenttype, CONTENTTYPE_FORM):
+		values := make(url.Values)
+		addExampleForm(values, "", value)
+		text = values.Encode()
+	default:
+		return nil, fmt.Errorf("Cannot synthesize example for content type %s", contenttype)
+	}
+
+	return &ApiExample{
+		ContentType: contenttype,
+		Description: "Synthesized example",
+		Text:        text,
+	}, nil
+}
+
+// paramStringValues returns the text values of a param, repeating array items for the form
+// style and joining them with commas otherwise.
+func paramStringValues(v interface{}, style ParamStyle) []string {
+	switch tv := v.(type) {
+	case string:
+		return []string{tv}
+	case []interface{}:
+		items := make([]string, 0, len(tv))
+		for _, item := range tv {
+			items = append(items, fmt.Sprint(item))
+		}
+		if style == PARAMSTYLE_FORM {
+			return items
+		}
+		return []string{strings.Join(items, ",")}
+	}
+	return []string{fmt.Sprint(v)}
+}
+
+// paramExampleValue returns the value of a param example, splitting array examples declared
+// as comma separated or json lists into their items.
+func paramExampleValue(text string, rdt *ApiDataType) interface{} {
+	text = strings.TrimSpace(text)
+	if rdt == nil || rdt.DataType != DATATYPE_ARRAY {
+		return text
+	}
+	var items []interface{}
+	if strings.HasPrefix(text, "[") && json.Unmarshal([]byte(text), &items) == nil {
+		return items
+	}
+	for _, item := range strings.Split(text, ",") {
+		items = append(items, strings.TrimSpace(item))
+	}
+	return items
+}
+
+// exampleMediaType returns a concrete content type matching the first of the media types,
+// which may be wildcards like image/*.
+func exampleMediaType(mediatypes []string) string {
+	if len(mediatypes) == 0 {
+		return "application/octet-stream"
+	}
+	m := strings.ToLower(strings.TrimSpace(mediatypes[0]))
+	switch m {
+	case "image/*":
+		return "image/png"
+	case "text/*":
+		return "text/plain"
+	case "audio/*":
+		return "audio/mpeg"
+	case "video/*":
+		return "video/mp4"
+	}
+	if strings.Contains(m, "*") {
+		return "application/octet-stream"
+	}
+	return m
+}
+
+func isXMLContentType(contenttype string) bool {
+	contenttype = strings.ToLower(strings.TrimSpace(contenttype))
+	return sameMediaType(contenttype, CONTENTTYPE_XML) || sameMediaType(contenttype, "text/xml") || contenttype == "xml" || strings.HasSuffix(contenttype, "+xml")
+}
+
+func writeExampleXML(buf *bytes.Buffer, name string, value interface{}, indent string) error {
+	switch v := value.(type) {
+	case *exampleObject:
+		fmt.Fprintf(buf, "%s<%s>\n", indent, name)
+		for _, k := range v.keys {
+			err := writeExampleXML(buf, k, v.values[k], indent+"  ")
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(buf, "%s</%s>\n", indent, name)
+	case []interface{}:
+		// array items are repeated elements with the field name
+		for _, item := range v {
+			err := writeExampleXML(buf, name, item, indent)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		fmt.Fprintf(buf, "%s<%s>", indent, name)
+		err := xml.EscapeText(buf, []byte(fmt.Sprint(v)))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(buf, "</%s>\n", name)
+	}
+	return nil
+}
+
+// addExampleForm flattens the value into form values, using dotted names for nested
+// fields and repeated names for arrays.
+func addExampleForm(values url.Values, name string, value interface{}) {
+	switch v := value.(type) {
+	case *exampleObject:
+		for _, k := range v.keys {
+			addExampleForm(values, joinFieldName(name, k), v.values[k])
+		}
+	case []interface{}:
+		for _, item := range v {
+			addExampleForm(values, name, item)
+		}
+	default:
+		if name == "" {
+			name = "value"
+		}
+		values.Add(name, fmt.Sprint(v))
+	}
+}
+
+// ExamplesWithFallback returns the examples with the content type, or a synthesized one if
+// there are none. Generators can use it to always show an example.
+func (p *Parser) ExamplesWithFallback(dt *ApiDataType, examples []*ApiExample, contenttype string) []*ApiExample {
+	var ret []*ApiExample
+	for _, ex := range examples {
+		if sameMediaType(ex.ContentType, contenttype) || (isJSONContentType(contenttype) && isJSONContentType(ex.ContentType)) {
+			ret = append(ret, ex)
+		}
+	}
+	if len(ret) == 0 && dt != nil {
+		if ex, err := NewExampleSynthesizer(p, 0).Synthesize(dt, contenttype); err == nil {
+			ret = append(ret, ex)
+		}
+	}
+	return ret
+}
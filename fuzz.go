@@ -0,0 +1,452 @@
+package trapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//
+// Fuzzer: sends random valid and invalid requests built from the documentation to a handler
+//
+
+type FuzzFinding struct {
+	Api     *Api
+	Request string
+	Body    string
+	// the request was built to follow the documentation
+	Valid  bool
+	Status int
+	// the value recovered if the handler panicked
+	Panic   interface{}
+	Message string
+}
+
+func (f *FuzzFinding) String() string {
+	kind := "invalid"
+	if f.Valid {
+		kind = "valid"
+	}
+	return NewParserError(fmt.Sprintf("%s (%s request %s)", f.Message, kind, f.Request), f.Api.Filename, f.Api.Line).Error()
+}
+
+type Fuzzer struct {
+	parser  *Parser
+	handler http.Handler
+	rand    *rand.Rand
+
+	// number of requests sent for each api
+	Iterations int
+}
+
+func NewFuzzer(parser *Parser, handler http.Handler, seed int64) *Fuzzer {
+	return &Fuzzer{
+		parser:     parser,
+		handler:    handler,
+		rand:       rand.New(rand.NewSource(seed)),
+		Iterations: 20,
+	}
+}
+
+type fuzzRequest struct {
+	method   string
+	uri      map[string]string
+	query    url.Values
+	headers  http.Header
+	cookies  map[string]string
+	body     interface{}
+	hasbody  bool
+	valid    bool
+	mutation string
+	// form or multipart params, files are multipart parts with their content type
+	form      url.Values
+	files     url.Values
+	multipart bool
+}
+
+func (r *fuzzRequest) setParam(pt ParamType, name string, value string) {
+	switch pt {
+	case PARAMTYPE_URI:
+		r.uri[name] = value
+	case PARAMTYPE_QUERY:
+		r.query.Set(name, value)
+	case PARAMTYPE_HEADER:
+		r.headers.Set(name, value)
+	case PARAMTYPE_COOKIE:
+		r.cookies[name] = value
+	case PARAMTYPE_FORM, PARAMTYPE_MULTIPART:
+		r.files.Del(name)
+		r.form.Set(name, value)
+	}
+}
+
+// addParam adds a repeated value to a query or form param.
+func (r *fuzzRequest) addParam(pt ParamType, name string, value string) {
+	switch pt {
+	case PARAMTYPE_QUERY:
+		r.query.Add(name, value)
+	case PARAMTYPE_FORM, PARAMTYPE_MULTIPART:
+		r.form.Add(name, value)
+	}
+}
+
+func (r *fuzzRequest) delParam(pt ParamType, name string) {
+	switch pt {
+	case PARAMTYPE_QUERY:
+		r.query.Del(name)
+	case PARAMTYPE_HEADER:
+		r.headers.Del(name)
+	case PARAMTYPE_COOKIE:
+		delete(r.cookies, name)
+	case PARAMTYPE_FORM, PARAMTYPE_MULTIPART:
+		r.files.Del(name)
+		r.form.Del(name)
+	}
+}
+
+// fuzzTextParamTypes are the param types sent as text.
+var fuzzTextParamTypes = []ParamType{PARAMTYPE_URI, PARAMTYPE_QUERY, PARAMTYPE_HEADER, PARAMTYPE_COOKIE, PARAMTYPE_FORM, PARAMTYPE_MULTIPART}
+
+// Run sends the requests to the handler, returning the panics, 5xx responses and status
+// codes not documented in the api.
+func (f *Fuzzer) Run() []*FuzzFinding {
+	var ret []*FuzzFinding
+	for _, api := range f.parser.Apis {
+		for i := 0; i < f.Iterations; i++ {
+			req := f.buildRequest(api)
+			// half of the requests are mutated to be invalid
+			if i%2 == 1 {
+				f.mutate(api, req)
+			}
+			if finding := f.send(api, req); finding != nil {
+				ret = append(ret, finding)
+			}
+		}
+	}
+	return ret
+}
+
+func (f *Fuzzer) synth() *ExampleSynthesizer {
+	ret := NewExampleSynthesizer(f.parser, f.rand.Int63()+1)
+	ret.OptionalFields = f.rand.Intn(2) == 0
+	ret.patternMisses = make(map[string]bool)
+	return ret
+}
+
+func (f *Fuzzer) buildRequest(api *Api) *fuzzRequest {
+	synth := f.synth()
+	ret := &fuzzRequest{
+		method:  strings.ToUpper(api.Method),
+		uri:     make(map[string]string),
+		query:   make(url.Values),
+		headers: make(http.Header),
+		cookies: make(map[string]string),
+		valid:   true,
+	}
+
+	for _, pt := range fuzzTextParamTypes {
+		pl, ok := api.Params[pt]
+		if !ok {
+			continue
+		}
+		if pt == PARAMTYPE_FORM || pt == PARAMTYPE_MULTIPART {
+			ret.form = make(url.Values)
+			ret.files = make(url.Values)
+			ret.multipart = pt == PARAMTYPE_MULTIPART
+		}
+		for _, pn := range pl.Order {
+			param := pl.List[pn]
+			if !param.Required && pt != PARAMTYPE_URI && f.rand.Intn(2) == 1 {
+				continue
+			}
+			if rdt := synth.validator.resolve(param.DataType); pt == PARAMTYPE_MULTIPART && rdt != nil && rdt.DataType == DATATYPE_BINARY {
+				ct := exampleMediaType(param.ContentTypes)
+				ret.files.Set(pn, ct)
+				continue
+			}
+			if param.Style == PARAMSTYLE_FORM {
+				values := paramStringValues(synth.value(param.DataType, pn), param.Style)
+				for idx, value := range values {
+					if idx == 0 {
+						ret.setParam(pt, pn, value)
+					} else {
+						ret.addParam(pt, pn, value)
+					}
+				}
+				continue
+			}
+			// patterns are followed using the example of the param
+			if rdt := synth.validator.resolve(param.DataType); rdt != nil && rdt.Pattern != "" && len(param.Examples) > 0 {
+				ret.setParam(pt, pn, strings.TrimSpace(param.Examples[0].Text))
+				continue
+			}
+			ret.setParam(pt, pn, f.stringValue(synth, param.DataType, pn))
+		}
+	}
+	if api.Headers != nil {
+		for _, hn := range api.Headers.Order {
+			if !api.Headers.List[hn][0].Required && f.rand.Intn(2) == 1 {
+				continue
+			}
+			ret.headers.Set(hn, f.stringValue(synth, api.Headers.List[hn][0].DataType, hn))
+		}
+	}
+	if apireq := jsonRequest(api.Requests); apireq != nil {
+		ret.body = synth.value(apireq.DataType, "")
+		ret.hasbody = true
+	}
+
+	// the handler may reject values not following their pattern
+	if len(synth.patternMisses) > 0 {
+		names := make([]string, 0, len(synth.patternMisses))
+		for name := range synth.patternMisses {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		ret.valid = false
+		ret.mutation = "values not matching the pattern of " + strings.Join(names, ", ")
+	}
+
+	return ret
+}
+
+// stringValue returns a valid value as text, using boundary values for integers.
+func (f *Fuzzer) stringValue(synth *ExampleSynthesizer, dt *ApiDataType, name string) string {
+	dt = synth.validator.resolve(dt)
+	if dt != nil && dt.DataType == DATATYPE_INTEGER && len(dt.Enum) == 0 && dt.Minimum == nil && dt.Maximum == nil && f.rand.Intn(3) == 0 {
+		return fuzzBoundaryIntegers[f.rand.Intn(len(fuzzBoundaryIntegers))]
+	}
+	return paramStringValues(synth.value(dt, name), PARAMSTYLE_DEFAULT)[0]
+}
+
+var (
+	fuzzBoundaryIntegers = []string{"0", "-1", "1", "2147483647", "-2147483648", "9223372036854775807", "-9223372036854775808"}
+	fuzzInvalidValues    = map[DataType][]string{
+		DATATYPE_INTEGER:  {"9223372036854775808", "1.5", "abc", ""},
+		DATATYPE_NUMBER:   {"1e400", "NaN-", "abc", ""},
+		DATATYPE_BOOLEAN:  {"maybe", "2", ""},
+		DATATYPE_DATE:     {"2020-13-45", "01/02/2020", "not-a-date", ""},
+		DATATYPE_TIME:     {"25:61:00", "noon", ""},
+		DATATYPE_DATETIME: {"2020-01-01", "2020-01-01T25:00:00Z", "not-a-datetime", ""},
+	}
+	fuzzInvalidJSONValues = []interface{}{nil, "string", 1.5, true, []interface{}{}, map[string]interface{}{}, "2020-13-45"}
+	fuzzInvalidEnumValue  = "fuzz-invalid-enum-value"
+)
+
+// fuzzConstraintValues returns values just outside the constraints of the data type.
+func fuzzConstraintValues(dt *ApiDataType) []string {
+	var ret []string
+	if dt.Minimum != nil {
+		ret = append(ret, strconv.FormatFloat(*dt.Minimum-1, 'f', -1, 64))
+	}
+	if dt.Maximum != nil {
+		ret = append(ret, strconv.FormatFloat(*dt.Maximum+1, 'f', -1, 64))
+	}
+	if dt.MinLength != nil && *dt.MinLength > 0 {
+		ret = append(ret, strings.Repeat("x", *dt.MinLength-1))
+	}
+	if dt.MaxLength != nil {
+		ret = append(ret, strings.Repeat("x", *dt.MaxLength+1))
+	}
+	return ret
+}
+
+func fuzzParamTypeName(pt ParamType) string {
+	return strings.ToLower(strings.TrimPrefix(pt.String(), "PARAMTYPE_"))
+}
+
+// mutate changes the request to break the documentation.
+func (f *Fuzzer) mutate(api *Api, req *fuzzRequest) {
+	var mutations []func() string
+
+	for _, pt := range fuzzTextParamTypes {
+		pl, ok := api.Params[pt]
+		if !ok {
+			continue
+		}
+		for _, pn := range pl.Order {
+			pt, pn, param := pt, pn, pl.List[pn]
+			values, ok := fuzzInvalidValues[param.DataType.DataType]
+			if len(param.DataType.Enum) > 0 {
+				values = append([]string{fuzzInvalidEnumValue}, values...)
+				ok = true
+			}
+			if cv := fuzzConstraintValues(param.DataType); len(cv) > 0 {
+				values = append(cv, values...)
+				ok = true
+			}
+			if ok {
+				mutations = append(mutations, func() string {
+					v := values[f.rand.Intn(len(values))]
+					// an empty uri param would not route to the api
+					if pt == PARAMTYPE_URI && v == "" {
+						v = "-"
+					}
+					req.setParam(pt, pn, v)
+					return fmt.Sprintf("invalid %s param %s '%s'", fuzzParamTypeName(pt), pn, v)
+				})
+			}
+			if pt != PARAMTYPE_URI && param.Required {
+				mutations = append(mutations, func() string {
+					req.delParam(pt, pn)
+					return fmt.Sprintf("missing required %s param %s", fuzzParamTypeName(pt), pn)
+				})
+			}
+		}
+	}
+
+	if api.Headers != nil {
+		for _, hn := range api.Headers.Order {
+			hn := hn
+			if !api.Headers.List[hn][0].Required {
+				continue
+			}
+			mutations = append(mutations, func() string {
+				req.headers.Del(hn)
+				return fmt.Sprintf("missing required header %s", hn)
+			})
+		}
+	}
+
+	if req.hasbody {
+		mutations = append(mutations, func() string {
+			return f.mutateBody(req)
+		})
+	}
+
+	if len(mutations) == 0 {
+		return
+	}
+	req.valid = false
+	req.mutation = mutations[f.rand.Intn(len(mutations))]()
+}
+
+func (f *Fuzzer) mutateBody(req *fuzzRequest) string {
+	obj, ok := req.body.(*exampleObject)
+	if !ok || len(obj.keys) == 0 {
+		req.body = fuzzInvalidJSONValues[f.rand.Intn(len(fuzzInvalidJSONValues))]
+		return "invalid body"
+	}
+
+	key := obj.keys[f.rand.Intn(len(obj.keys))]
+	switch f.rand.Intn(4) {
+	case 0:
+		obj.remove(key)
+		return fmt.Sprintf("missing body field %s", key)
+	case 1:
+		obj.set("fuzz_extra_field", "extra")
+		return "extra body field"
+	case 2:
+		bi, _ := strconv.ParseInt(fuzzBoundaryIntegers[f.rand.Intn(len(fuzzBoundaryIntegers))], 10, 64)
+		obj.set(key, bi)
+		return fmt.Sprintf("boundary integer in body field %s", key)
+	default:
+		obj.set(key, fuzzInvalidJSONValues[f.rand.Intn(len(fuzzInvalidJSONValues))])
+		return fmt.Sprintf("invalid value in body field %s", key)
+	}
+}
+
+func (f *Fuzzer) send(api *Api, freq *fuzzRequest) (finding *FuzzFinding) {
+	path := api.Path
+	for pn, pv := range freq.uri {
+		path = strings.Replace(path, "<"+pn+">", url.PathEscape(pv), -1)
+	}
+	target := path
+	if len(freq.query) > 0 {
+		target += "?" + freq.query.Encode()
+	}
+
+	var body, contenttype string
+	if freq.hasbody {
+		b, err := json.Marshal(freq.body)
+		if err == nil {
+			body = string(b)
+		}
+		contenttype = CONTENTTYPE_JSON
+	} else if freq.multipart {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		mw.SetBoundary("trapi-fuzz-boundary")
+		for _, name := range sortedKeys(freq.form) {
+			for _, value := range freq.form[name] {
+				mw.WriteField(name, value)
+			}
+		}
+		for _, name := range sortedKeys(freq.files) {
+			ct := freq.files.Get(name)
+			h := make(textproto.MIMEHeader)
+			h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, name, name))
+			h.Set("Content-Type", ct)
+			if pw, err := mw.CreatePart(h); err == nil {
+				pw.Write([]byte("fuzz file content"))
+			}
+		}
+		mw.Close()
+		body = buf.String()
+		contenttype = mw.FormDataContentType()
+	} else if freq.form != nil {
+		body = freq.form.Encode()
+		contenttype = CONTENTTYPE_FORM
+	}
+
+	req := httptest.NewRequest(freq.method, target, strings.NewReader(body))
+	for hn, hv := range freq.headers {
+		req.Header[hn] = hv
+	}
+	for cn, cv := range freq.cookies {
+		req.AddCookie(&http.Cookie{Name: cn, Value: cv})
+	}
+	if contenttype != "" {
+		req.Header.Set("Content-Type", contenttype)
+	}
+
+	newFinding := func(status int, message string) *FuzzFinding {
+		if freq.mutation != "" {
+			message += ": " + freq.mutation
+		}
+		return &FuzzFinding{
+			Api:     api,
+			Request: freq.method + " " + target,
+			Body:    body,
+			Valid:   freq.valid,
+			Status:  status,
+			Message: message,
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	defer func() {
+		if r := recover(); r != nil {
+			finding = newFinding(0, fmt.Sprintf("handler panicked: %v", r))
+			finding.Panic = r
+		}
+	}()
+	f.handler.ServeHTTP(rec, req)
+
+	if rec.Code >= 500 {
+		return newFinding(rec.Code, fmt.Sprintf("server error %d", rec.Code))
+	}
+	if api.Responses == nil || len(api.Responses.List[strconv.Itoa(rec.Code)]) == 0 {
+		return newFinding(rec.Code, fmt.Sprintf("status %d not documented", rec.Code))
+	}
+	return nil
+}
+
+// sortedKeys returns the names of the values in order.
+func sortedKeys(values url.Values) []string {
+	ret := make([]string, 0, len(values))
+	for k := range values {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,335 @@
+package trapi
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//
+// Contract test generator: emits Go tests checking live endpoints against the documentation
+//
+
+type ContractTestGenerator struct {
+	// package name of the generated file
+	PackageName string
+	// Go expression returning the http.Handler under test
+	Handler string
+	// source directories and tags parsed at test time to load the documentation
+	Dirs []string
+	Tags []string
+}
+
+func NewContractTestGenerator(packagename string, handler string) *ContractTestGenerator {
+	return &ContractTestGenerator{
+		PackageName: packagename,
+		Handler:     handler,
+	}
+}
+
+func (g *ContractTestGenerator) AddDir(dir string) {
+	g.Dirs = append(g.Dirs, dir)
+}
+
+func (g *ContractTestGenerator) AddTag(tag string) {
+	g.Tags = append(g.Tags, tag)
+}
+
+var reContractTestName = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+type contractTestRequest struct {
+	Method  string
+	Target  string
+	Body    string
+	Headers [][2]string
+}
+
+func (g *ContractTestGenerator) Generate(parser *Parser, out io.Writer) error {
+	synth := NewExampleSynthesizer(parser, 0)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by trapi. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", g.PackageName)
+	fmt.Fprintf(&buf, "import (\n\t\"encoding/json\"\n\t\"net/http/httptest\"\n\t\"strings\"\n\t\"sync\"\n\t\"testing\"\n\n")
+	fmt.Fprintf(&buf, "\t\"github.com/RangelReale/gocompar\"\n\t\"github.com/RangelReale/trapi\"\n)\n\n")
+
+	g.writeHelpers(&buf)
+
+	names := make(map[string]int)
+	for _, api := range parser.Apis {
+		// the request built from the examples can only check the primary success response
+		status, responses := contractSuccessResponses(api)
+		if len(responses) == 0 {
+			continue
+		}
+
+		req, err := g.buildRequest(synth, api)
+		if err != nil {
+			return NewParserError(err.Error(), api.Filename, api.Line)
+		}
+
+		basename := "TestContract_" + strings.Trim(reContractTestName.ReplaceAllString(strings.ToUpper(api.Method[:1])+strings.ToLower(api.Method[1:])+"_"+api.Path, "_"), "_")
+		if api.Version != "" {
+			basename += "_V" + reContractTestName.ReplaceAllString(api.Version, "_")
+		}
+		testName := func(suffix string) string {
+			name := basename + suffix
+			names[name]++
+			if names[name] > 1 {
+				name = fmt.Sprintf("%s_%d", name, names[name])
+			}
+			return name
+		}
+
+		g.writeTest(&buf, testName(""), api, req, status, responses[0].ContentType, nil)
+
+		// one test per response example, comparing the response to it
+		for _, rb := range responses {
+			for ei, example := range rb.ApiResponse.Examples {
+				g.writeTest(&buf, testName(fmt.Sprintf("_Example%d", ei+1)), api, req, status, rb.ContentType, example)
+			}
+		}
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(src)
+	return err
+}
+
+// contractSuccessResponses returns the lowest documented success status code and its responses.
+func contractSuccessResponses(api *Api) (int, []*ApiResponseBody) {
+	if api.Responses == nil {
+		return 0, nil
+	}
+
+	codes := make([]string, 0, len(api.Responses.List))
+	for c := range api.Responses.List {
+		codes = append(codes, c)
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		status, err := strconv.Atoi(code)
+		if err != nil {
+			continue
+		}
+		var ret []*ApiResponseBody
+		for _, rb := range api.Responses.List[code] {
+			if rb.ApiResponse.ResponseType == RESPONSETYPE_SUCCESS {
+				ret = append(ret, rb)
+			}
+		}
+		if len(ret) > 0 {
+			return status, ret
+		}
+	}
+	return 0, nil
+}
+
+func (g *ContractTestGenerator) writeHelpers(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "var (\n\tcontractOnce sync.Once\n\tcontractParser *trapi.Parser\n\tcontractErr error\n)\n\n")
+	// apis are found by version, as the same path may be documented in several versions
+	fmt.Fprintf(buf, "func contractApi(t *testing.T, method string, path string, version string) (*trapi.Parser, *trapi.Api) {\n")
+	fmt.Fprintf(buf, "\tcontractOnce.Do(func() {\n")
+	fmt.Fprintf(buf, "\t\tcontractParser = trapi.NewParser(gocompar.NewParser())\n")
+	for _, d := range g.Dirs {
+		fmt.Fprintf(buf, "\t\tcontractParser.AddDir(%s)\n", strconv.Quote(d))
+	}
+	for _, tag := range g.Tags {
+		fmt.Fprintf(buf, "\t\tcontractParser.AddTag(%s)\n", strconv.Quote(tag))
+	}
+	fmt.Fprintf(buf, "\t\tcontractErr = contractParser.Parse()\n\t})\n")
+	fmt.Fprintf(buf, "\tif contractErr != nil {\n\t\tt.Fatalf(\"error parsing api documentation: %%s\", contractErr)\n\t}\n")
+	fmt.Fprintf(buf, "\tfor _, api := range contractParser.Apis {\n\t\tif api.Method == method && api.Path == path && api.Version == version {\n\t\t\treturn contractParser, api\n\t\t}\n\t}\n")
+	fmt.Fprintf(buf, "\tt.Fatalf(\"api {%%s} %%s version '%%s' not found in documentation\", method, path, version)\n\treturn nil, nil\n}\n\n")
+
+	fmt.Fprintf(buf, "func contractDecode(t *testing.T, data []byte, what string) interface{} {\n")
+	fmt.Fprintf(buf, "\tvar ret interface{}\n\tif err := json.Unmarshal(data, &ret); err != nil {\n\t\tt.Fatalf(\"invalid json in %%s: %%s\", what, err)\n\t}\n\treturn ret\n}\n\n")
+
+	// values of the example must be present in the response with the same json type
+	fmt.Fprintf(buf, "func contractSameShape(example interface{}, actual interface{}) bool {\n")
+	fmt.Fprintf(buf, "\tif example == nil || actual == nil {\n\t\treturn true\n\t}\n")
+	fmt.Fprintf(buf, "\tswitch ev := example.(type) {\n")
+	fmt.Fprintf(buf, "\tcase map[string]interface{}:\n\t\tav, ok := actual.(map[string]interface{})\n\t\tif !ok {\n\t\t\treturn false\n\t\t}\n")
+	fmt.Fprintf(buf, "\t\tfor k, v := range ev {\n\t\t\tif a, ok := av[k]; !ok || !contractSameShape(v, a) {\n\t\t\t\treturn false\n\t\t\t}\n\t\t}\n\t\treturn true\n")
+	fmt.Fprintf(buf, "\tcase []interface{}:\n\t\tav, ok := actual.([]interface{})\n\t\tif !ok {\n\t\t\treturn false\n\t\t}\n")
+	fmt.Fprintf(buf, "\t\tif len(ev) > 0 && len(av) > 0 {\n\t\t\treturn contractSameShape(ev[0], av[0])\n\t\t}\n\t\treturn true\n")
+	fmt.Fprintf(buf, "\tcase string:\n\t\t_, ok := actual.(string)\n\t\treturn ok\n")
+	fmt.Fprintf(buf, "\tcase float64:\n\t\t_, ok := actual.(float64)\n\t\treturn ok\n")
+	fmt.Fprintf(buf, "\tcase bool:\n\t\t_, ok := actual.(bool)\n\t\treturn ok\n")
+	fmt.Fprintf(buf, "\t}\n\treturn false\n}\n\n")
+}
+
+func (g *ContractTestGenerator) writeTest(buf *bytes.Buffer, name string, api *Api, req *contractTestRequest, status int, contenttype string, example *ApiExample) {
+	fmt.Fprintf(buf, "// %s checks {%s} %s returning %d", name, api.Method, api.Path, status)
+	if example != nil {
+		fmt.Fprintf(buf, " like example '%s' [%s:%d]", example.Description, example.Filename, example.Line)
+	}
+	fmt.Fprintf(buf, "\nfunc %s(t *testing.T) {\n", name)
+	fmt.Fprintf(buf, "\tparser, api := contractApi(t, %s, %s, %s)\n\n", strconv.Quote(api.Method), strconv.Quote(api.Path), strconv.Quote(api.Version))
+	fmt.Fprintf(buf, "\treq := httptest.NewRequest(%s, %s, strings.NewReader(%s))\n", strconv.Quote(req.Method), strconv.Quote(req.Target), strconv.Quote(req.Body))
+	for _, h := range req.Headers {
+		fmt.Fprintf(buf, "\treq.Header.Set(%s, %s)\n", strconv.Quote(h[0]), strconv.Quote(h[1]))
+	}
+	if contenttype != "" && contenttype != "-" {
+		fmt.Fprintf(buf, "\treq.Header.Set(\"Accept\", %s)\n", strconv.Quote(contenttype))
+	}
+	fmt.Fprintf(buf, "\trec := httptest.NewRecorder()\n\t(%s).ServeHTTP(rec, req)\n\n", g.Handler)
+	fmt.Fprintf(buf, "\tif rec.Code != %d {\n\t\tt.Fatalf(\"expected status %d, got %%d: %%s\", rec.Code, rec.Body.String())\n\t}\n", status, status)
+	fmt.Fprintf(buf, "\tif verrs := trapi.NewResponseValidator(parser, trapi.RESPONSEVALIDATION_LOG).ValidateResponse(api, rec.Code, rec.Header(), rec.Body.Bytes()); len(verrs) > 0 {\n")
+	fmt.Fprintf(buf, "\t\tfor _, verr := range verrs {\n\t\t\tt.Error(verr)\n\t\t}\n\t}\n")
+	if example != nil {
+		if isJSONContentType(example.ContentType) || isJSONContentType(contenttype) {
+			fmt.Fprintf(buf, "\n\texpected := contractDecode(t, []byte(%s), \"example\")\n", strconv.Quote(example.Text))
+			fmt.Fprintf(buf, "\tactual := contractDecode(t, rec.Body.Bytes(), \"response body\")\n")
+			fmt.Fprintf(buf, "\tif !contractSameShape(expected, actual) {\n\t\tt.Errorf(\"response does not match the example: %%s\", rec.Body.String())\n\t}\n")
+		} else {
+			fmt.Fprintf(buf, "\n\tif strings.TrimSpace(rec.Body.String()) != %s {\n\t\tt.Errorf(\"response does not match the example: %%s\", rec.Body.String())\n\t}\n", strconv.Quote(strings.TrimSpace(example.Text)))
+		}
+	}
+	fmt.Fprintf(buf, "}\n\n")
+}
+
+// buildRequest builds a request from the param examples, or synthesized values.
+func (g *ContractTestGenerator) buildRequest(synth *ExampleSynthesizer, api *Api) (*contractTestRequest, error) {
+	ret := &contractTestRequest{
+		Method: strings.ToUpper(api.Method),
+	}
+
+	// text values of the param following its style, from the example or synthesized
+	paramValues := func(param *ApiParam) []string {
+		if len(param.Examples) > 0 {
+			return paramStringValues(paramExampleValue(param.Examples[0].Text, synth.validator.resolve(param.DataType)), param.Style)
+		}
+		return paramStringValues(synth.value(param.DataType, param.Name), param.Style)
+	}
+	paramValue := func(param *ApiParam) string {
+		return strings.Join(paramValues(param), ",")
+	}
+
+	path := api.Path
+	if pl, ok := api.Params[PARAMTYPE_URI]; ok {
+		for _, pn := range pl.Order {
+			path = strings.Replace(path, "<"+pn+">", url.PathEscape(paramValue(pl.List[pn])), -1)
+		}
+	}
+
+	query := make(url.Values)
+	if pl, ok := api.Params[PARAMTYPE_QUERY]; ok {
+		for _, pn := range pl.Order {
+			if param := pl.List[pn]; param.Required || len(param.Examples) > 0 {
+				for _, v := range paramValues(param) {
+					query.Add(pn, v)
+				}
+			}
+		}
+	}
+	ret.Target = path
+	if len(query) > 0 {
+		ret.Target += "?" + query.Encode()
+	}
+
+	if apireq := jsonRequest(api.Requests); apireq != nil {
+		if ex := findExample(apireq.Examples, CONTENTTYPE_JSON); ex != nil {
+			ret.Body = ex.Text
+		} else if ex := findExample(apireq.DataType.Examples, CONTENTTYPE_JSON); ex != nil {
+			ret.Body = ex.Text
+		} else {
+			ex, err := synth.Synthesize(apireq.DataType, CONTENTTYPE_JSON)
+			if err != nil {
+				return nil, err
+			}
+			ret.Body = ex.Text
+		}
+		ret.Headers = append(ret.Headers, [2]string{"Content-Type", CONTENTTYPE_JSON})
+	}
+
+	if api.Headers != nil {
+		for _, hn := range api.Headers.Order {
+			if !api.Headers.List[hn][0].Required {
+				continue
+			}
+			ret.Headers = append(ret.Headers, [2]string{hn, fmt.Sprint(synth.value(api.Headers.List[hn][0].DataType, hn))})
+		}
+	}
+
+	if pl, ok := api.Params[PARAMTYPE_HEADER]; ok {
+		for _, pn := range pl.Order {
+			if param := pl.List[pn]; param.Required || len(param.Examples) > 0 {
+				ret.Headers = append(ret.Headers, [2]string{pn, paramValue(param)})
+			}
+		}
+	}
+
+	if pl, ok := api.Params[PARAMTYPE_COOKIE]; ok {
+		var cookies []string
+		for _, pn := range pl.Order {
+			if param := pl.List[pn]; param.Required || len(param.Examples) > 0 {
+				cookies = append(cookies, (&http.Cookie{Name: pn, Value: paramValue(param)}).String())
+			}
+		}
+		if len(cookies) > 0 {
+			ret.Headers = append(ret.Headers, [2]string{"Cookie", strings.Join(cookies, "; ")})
+		}
+	}
+
+	if pl, ok := api.Params[PARAMTYPE_FORM]; ok {
+		form := make(url.Values)
+		for _, pn := range pl.Order {
+			if param := pl.List[pn]; param.Required || len(param.Examples) > 0 {
+				for _, v := range paramValues(param) {
+					form.Add(pn, v)
+				}
+			}
+		}
+		ret.Body = form.Encode()
+		ret.Headers = append(ret.Headers, [2]string{"Content-Type", CONTENTTYPE_FORM})
+	}
+
+	if pl, ok := api.Params[PARAMTYPE_MULTIPART]; ok {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		mw.SetBoundary("trapi-contract-boundary")
+		for _, pn := range pl.Order {
+			param := pl.List[pn]
+			if !param.Required && len(param.Examples) == 0 {
+				continue
+			}
+			if rdt := synth.validator.resolve(param.DataType); rdt != nil && rdt.DataType == DATATYPE_BINARY {
+				ct := exampleMediaType(param.ContentTypes)
+				h := make(textproto.MIMEHeader)
+				h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, pn, pn))
+				h.Set("Content-Type", ct)
+				pw, err := mw.CreatePart(h)
+				if err != nil {
+					return nil, err
+				}
+				pw.Write([]byte("contract file content"))
+				continue
+			}
+			for _, v := range paramValues(param) {
+				mw.WriteField(pn, v)
+			}
+		}
+		err := mw.Close()
+		if err != nil {
+			return nil, err
+		}
+		ret.Body = buf.String()
+		ret.Headers = append(ret.Headers, [2]string{"Content-Type", mw.FormDataContentType()})
+	}
+
+	return ret, nil
+}
@@ -1,6 +1,7 @@
 package trapi
 
 import (
+	"regexp"
 	"strings"
 )
 
@@ -18,6 +19,8 @@ const (
 	DATATYPE_DATE
 	DATATYPE_TIME
 	DATATYPE_DATETIME
+	DATATYPE_UNION
+	DATATYPE_MAP
 	DATATYPE_CUSTOM = 1000
 )
 
@@ -45,6 +48,10 @@ func (dt DataType) String() string {
 		return "DATATYPE_TIME"
 	case DATATYPE_DATETIME:
 		return "DATATYPE_DATETIME"
+	case DATATYPE_UNION:
+		return "DATATYPE_UNION"
+	case DATATYPE_MAP:
+		return "DATATYPE_MAP"
 	case DATATYPE_CUSTOM:
 		return "DATATYPE_CUSTOM"
 	}
@@ -58,6 +65,10 @@ const (
 	PARAMTYPE_QUERY
 	PARAMTYPE_URI
 	PARAMTYPE_BODY
+	PARAMTYPE_HEADER
+	PARAMTYPE_COOKIE
+	PARAMTYPE_FORM
+	PARAMTYPE_MULTIPART
 )
 
 func (pt ParamType) String() string {
@@ -70,10 +81,50 @@ func (pt ParamType) String() string {
 		return "PARAMTYPE_URI"
 	case PARAMTYPE_BODY:
 		return "PARAMTYPE_BODY"
+	case PARAMTYPE_HEADER:
+		return "PARAMTYPE_HEADER"
+	case PARAMTYPE_COOKIE:
+		return "PARAMTYPE_COOKIE"
+	case PARAMTYPE_FORM:
+		return "PARAMTYPE_FORM"
+	case PARAMTYPE_MULTIPART:
+		return "PARAMTYPE_MULTIPART"
 	}
 	return "PARAMTYPE_UNKNOWN"
 }
 
+// ParamStyle is the serialization of array and object params in queries and forms.
+type ParamStyle int
+
+const (
+	// arrays as comma-delimited or repeated values, object keys as params
+	PARAMSTYLE_DEFAULT ParamStyle = iota
+	// arrays as repeated values, ids=1&ids=2
+	PARAMSTYLE_FORM
+	// arrays as a comma-delimited value, ids=1,2
+	PARAMSTYLE_COMMA
+	// object keys in brackets, filter[name]=x
+	PARAMSTYLE_DEEPOBJECT
+	// object keys after a dot, filter.name=x
+	PARAMSTYLE_DOTTED
+)
+
+func (ps ParamStyle) String() string {
+	switch ps {
+	case PARAMSTYLE_DEFAULT:
+		return "PARAMSTYLE_DEFAULT"
+	case PARAMSTYLE_FORM:
+		return "PARAMSTYLE_FORM"
+	case PARAMSTYLE_COMMA:
+		return "PARAMSTYLE_COMMA"
+	case PARAMSTYLE_DEEPOBJECT:
+		return "PARAMSTYLE_DEEPOBJECT"
+	case PARAMSTYLE_DOTTED:
+		return "PARAMSTYLE_DOTTED"
+	}
+	return "PARAMSTYLE_UNKNOWN"
+}
+
 type ResponseType int
 
 const (
@@ -94,6 +145,32 @@ func (rt ResponseType) String() string {
 	return "RESPONSETYPE_UNKNOWN"
 }
 
+type SecuritySchemeType int
+
+const (
+	SECURITYSCHEME_UNKNOWN SecuritySchemeType = iota
+	SECURITYSCHEME_BEARER
+	SECURITYSCHEME_APIKEY
+	SECURITYSCHEME_BASIC
+	SECURITYSCHEME_OAUTH2
+)
+
+func (st SecuritySchemeType) String() string {
+	switch st {
+	case SECURITYSCHEME_UNKNOWN:
+		return "SECURITYSCHEME_UNKNOWN"
+	case SECURITYSCHEME_BEARER:
+		return "SECURITYSCHEME_BEARER"
+	case SECURITYSCHEME_APIKEY:
+		return "SECURITYSCHEME_APIKEY"
+	case SECURITYSCHEME_BASIC:
+		return "SECURITYSCHEME_BASIC"
+	case SECURITYSCHEME_OAUTH2:
+		return "SECURITYSCHEME_OAUTH2"
+	}
+	return "SECURITYSCHEME_UNKNOWN"
+}
+
 func ParseParamType(param_type string) ParamType {
 	switch param_type {
 	case "query":
@@ -102,11 +179,37 @@ func ParseParamType(param_type string) ParamType {
 		return PARAMTYPE_URI
 	case "body":
 		return PARAMTYPE_BODY
+	case "header":
+		return PARAMTYPE_HEADER
+	case "cookie":
+		return PARAMTYPE_COOKIE
+	case "form":
+		return PARAMTYPE_FORM
+	case "multipart":
+		return PARAMTYPE_MULTIPART
 	default:
 		return PARAMTYPE_UNKNOWN
 	}
 }
 
+// ParseParamStyle returns the style and whether it is known.
+func ParseParamStyle(param_style string) (ParamStyle, bool) {
+	switch param_style {
+	case "":
+		return PARAMSTYLE_DEFAULT, true
+	case "form":
+		return PARAMSTYLE_FORM, true
+	case "comma":
+		return PARAMSTYLE_COMMA, true
+	case "deepObject":
+		return PARAMSTYLE_DEEPOBJECT, true
+	case "dotted":
+		return PARAMSTYLE_DOTTED, true
+	default:
+		return PARAMSTYLE_DEFAULT, false
+	}
+}
+
 func ParseResponseType(response_type string) ResponseType {
 	switch response_type {
 	case "success":
@@ -118,6 +221,21 @@ func ParseResponseType(response_type string) ResponseType {
 	}
 }
 
+func ParseSecuritySchemeType(scheme_type string) SecuritySchemeType {
+	switch scheme_type {
+	case "bearer":
+		return SECURITYSCHEME_BEARER
+	case "apiKey":
+		return SECURITYSCHEME_APIKEY
+	case "basic":
+		return SECURITYSCHEME_BASIC
+	case "oauth2":
+		return SECURITYSCHEME_OAUTH2
+	default:
+		return SECURITYSCHEME_UNKNOWN
+	}
+}
+
 type ApiDataType struct {
 	DataTypeName  string
 	DataType      DataType
@@ -130,18 +248,55 @@ type ApiDataType struct {
 	Examples      []*ApiExample
 	BuiltIn       bool
 	Override      bool
+	// allowed values, if restricted
+	Enum []*ApiEnumValue
+	// member types of unions, values match exactly one of them. OneOfTypes are their full
+	// data types, in the same order.
+	OneOf         []string
+	OneOfTypes    []*ApiDataType
+	Discriminator *ApiDiscriminator
+	// full data type of the array elements, which may be arrays themselves. ItemType is
+	// its name, nil for anonymous elements like inline objects or nested arrays.
+	ElementType *ApiDataType
+	// key and value types of maps, as declared, and their full data types
+	KeyType       *string
+	ValueType     *string
+	KeyDataType   *ApiDataType
+	ValueDataType *ApiDataType
+	// null values are accepted
+	Nullable bool
+	ApiConstraints
 }
 
 func (a *ApiDataType) Clone() *ApiDataType {
 	ret := &ApiDataType{
-		DataTypeName: a.DataTypeName,
-		DataType:     a.DataType,
-		ItemType:     a.ItemType,
-		ParentType:   a.ParentType,
-		Description:  a.Description,
-		Examples:     a.Examples,
-		BuiltIn:      a.BuiltIn,
-		Override:     a.Override,
+		DataTypeName:   a.DataTypeName,
+		DataType:       a.DataType,
+		ItemType:       a.ItemType,
+		ParentType:     a.ParentType,
+		Description:    a.Description,
+		Examples:       a.Examples,
+		BuiltIn:        a.BuiltIn,
+		Override:       a.Override,
+		Enum:           a.Enum,
+		OneOf:          a.OneOf,
+		Discriminator:  a.Discriminator,
+		KeyType:        a.KeyType,
+		ValueType:      a.ValueType,
+		Nullable:       a.Nullable,
+		ApiConstraints: a.ApiConstraints,
+	}
+	if a.ElementType != nil {
+		ret.ElementType = a.ElementType.Clone()
+	}
+	for _, m := range a.OneOfTypes {
+		ret.OneOfTypes = append(ret.OneOfTypes, m.Clone())
+	}
+	if a.KeyDataType != nil {
+		ret.KeyDataType = a.KeyDataType.Clone()
+	}
+	if a.ValueDataType != nil {
+		ret.ValueDataType = a.ValueDataType.Clone()
 	}
 	if a.Items != nil {
 		ret.Items = make(map[string]*ApiDataTypeField)
@@ -150,6 +305,9 @@ func (a *ApiDataType) Clone() *ApiDataType {
 				FieldName:   av.FieldName,
 				Required:    av.Required,
 				ApiDataType: av.ApiDataType.Clone(),
+				Deprecated:  av.Deprecated,
+				Default:     av.Default,
+				Nullable:    av.Nullable,
 			}
 		}
 	}
@@ -166,23 +324,141 @@ func (a *ApiDataType) Clone() *ApiDataType {
 	return ret
 }
 
+// ApiConstraints restricts the values of a data type. Nil limits are not checked.
+type ApiConstraints struct {
+	// numbers
+	Minimum *float64
+	Maximum *float64
+	// strings
+	MinLength *int
+	MaxLength *int
+	Pattern   string
+	// compiled Pattern, shared by concurrent validations
+	PatternRegexp *regexp.Regexp
+	// like email, uuid, uri, int64
+	Format string
+	// arrays
+	MinItems *int
+	MaxItems *int
+}
+
+// ApiDiscriminator is the field of union values that names their member type.
+type ApiDiscriminator struct {
+	Field string
+	// field values to member types, values not mapped are the member type names
+	Mapping      map[string]string
+	MappingOrder []string
+}
+
+// DataTypeName returns the member type of the discriminator value.
+func (d *ApiDiscriminator) DataTypeName(value string) string {
+	if dt, ok := d.Mapping[value]; ok {
+		return dt
+	}
+	return value
+}
+
+// Value returns the discriminator value of the member type.
+func (d *ApiDiscriminator) Value(datatypename string) string {
+	for _, v := range d.MappingOrder {
+		if d.Mapping[v] == datatypename {
+			return v
+		}
+	}
+	return datatypename
+}
+
+type ApiEnumValue struct {
+	Value       string
+	Description string
+}
+
 type ApiDataTypeField struct {
 	FieldName   string
 	Required    bool
 	ApiDataType *ApiDataType
+	Deprecated  *ApiDeprecated
+	// value used when an optional field is absent
+	Default *string
+	// the field may be null, while Required tells whether it may be absent
+	Nullable bool
+}
+
+type ApiDeprecated struct {
+	Since       string
+	Replacement string
+	Description string
 }
 
 type Api struct {
 	Method      string
 	Path        string
 	Description string
+	Handler     string
 	Params      ApiParamTypeList
+	Requests    *ApiRequestList
 	Responses   *ApiResponseList
 	Headers     *ApiHeaderList
+	Deprecated  *ApiDeprecated
+	Version     string
+	Group       string
+	// operation id, unique between apis
+	Name string
+	// alternative requirements, any of them allows access. Empty if the api is public.
+	Security    []ApiSecurityRequirement
+	Permissions []*ApiPermission
 
 	SPIB_Filename
 }
 
+type ApiSecurityScheme struct {
+	Name        string
+	Type        SecuritySchemeType
+	Description string
+	// bearer token format, like JWT
+	BearerFormat string
+	// apiKey location (header, query or cookie) and name
+	In        string
+	ParamName string
+	// oauth2 flows
+	Flows []*ApiSecurityFlow
+
+	SPIB_Filename
+}
+
+// HasScope returns whether any of the oauth2 flows declares the scope.
+func (s *ApiSecurityScheme) HasScope(scope string) bool {
+	for _, f := range s.Flows {
+		if _, ok := f.Scopes[scope]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+type ApiSecurityFlow struct {
+	// implicit, password, clientCredentials or authorizationCode
+	Flow             string
+	AuthorizationUrl string
+	TokenUrl         string
+	RefreshUrl       string
+	Scopes           map[string]string
+	ScopesOrder      []string
+}
+
+type ApiPermission struct {
+	Name        string
+	Description string
+}
+
+type ApiSecurity struct {
+	Scheme string
+	Scopes []string
+}
+
+// ApiSecurityRequirement lists the schemes that must all be satisfied.
+type ApiSecurityRequirement []*ApiSecurity
+
 type ApiList struct {
 	Path     string
 	SubItems []*ApiList
@@ -218,19 +494,51 @@ func (a *ApiList) Add(api *Api) {
 	cura.Apis = append(cura.Apis, api)
 }
 
+type ApiGroup struct {
+	Name        string
+	Description string
+	Apis        []*Api
+}
+
+// ApiGroupList lists the apis by @apiGroup, sorted by name. Apis without group are in a
+// group with an empty name at the end.
+type ApiGroupList struct {
+	Groups []*ApiGroup
+}
+
+func (a *ApiGroupList) Find(name string) *ApiGroup {
+	for _, g := range a.Groups {
+		if g.Name == name {
+			return g
+		}
+	}
+	return nil
+}
+
 type ApiDefine struct {
 	DefineType string
 	Name       string
 	DataType   *ApiDataType
 	Examples   []*ApiExample
+	Deprecated *ApiDeprecated
+	Version    string
 
 	SPIB_Filename
 }
 
 type ApiParam struct {
-	Name     string
-	DataType *ApiDataType
-	Examples []*ApiExample
+	Name       string
+	Required   bool
+	DataType   *ApiDataType
+	Examples   []*ApiExample
+	Deprecated *ApiDeprecated
+	// value used when an optional param is absent
+	Default *string
+	// allowed content types of multipart file parts
+	ContentTypes []string
+	Style        ParamStyle
+	// name of the object param the param was expanded from
+	Parent string
 
 	SPIB_Filename
 }
@@ -246,6 +554,7 @@ type ApiHeader struct {
 	Name        string
 	DataType    *ApiDataType
 	Description string
+	Required    bool
 
 	SPIB_Filename
 }
@@ -263,6 +572,28 @@ type ApiExample struct {
 	SPIB_Filename
 }
 
+type ApiRequest struct {
+	DataType    *ApiDataType
+	Description string
+	Required    bool
+
+	Examples []*ApiExample
+
+	SPIB_Filename
+}
+
+// ApiRequestList lists the request bodies by content type. Bodies declared with
+// @apiParam body have the content type "-", accepting any.
+type ApiRequestList struct {
+	List  map[string]*ApiRequestBody
+	Order []string
+}
+
+type ApiRequestBody struct {
+	ContentType string
+	ApiRequest  *ApiRequest
+}
+
 type ApiResponse struct {
 	ResponseType ResponseType
 	DataType     *ApiDataType
@@ -0,0 +1,129 @@
+package trapi
+
+import (
+	"fmt"
+	"sort"
+)
+
+//
+// Lint: reports questionable documentation that is not a parse error
+//
+
+type lintRule func(p *Parser) []*ParserError
+
+var lintRules = []lintRule{
+	lintDeprecatedTypes,
+}
+
+// Lint runs all lint rules on the parsed apis.
+func (p *Parser) Lint() []*ParserError {
+	var ret []*ParserError
+	for _, rule := range lintRules {
+		ret = append(ret, rule(p)...)
+	}
+	return ret
+}
+
+// lintDeprecatedTypes reports non-deprecated apis that reference deprecated types.
+func lintDeprecatedTypes(p *Parser) []*ParserError {
+	deprecated := make(map[string]*ApiDefine)
+	for _, d := range p.ApiDefines {
+		if d.Deprecated != nil {
+			deprecated[d.Name] = d
+		}
+	}
+	if len(deprecated) == 0 {
+		return nil
+	}
+
+	var ret []*ParserError
+	for _, api := range p.Apis {
+		if api.Deprecated != nil {
+			continue
+		}
+
+		found := make(map[string]bool)
+		visited := make(map[*ApiDataType]bool)
+		for _, pl := range api.Params {
+			for _, param := range pl.List {
+				if param.Deprecated == nil {
+					findDeprecatedTypes(param.DataType, deprecated, found, visited)
+				}
+			}
+		}
+		findDeprecatedHeaderTypes(api.Headers, deprecated, found, visited)
+		if api.Requests != nil {
+			for _, rb := range api.Requests.List {
+				findDeprecatedTypes(rb.ApiRequest.DataType, deprecated, found, visited)
+			}
+		}
+		if api.Responses != nil {
+			for _, bodies := range api.Responses.List {
+				for _, rb := range bodies {
+					findDeprecatedTypes(rb.ApiResponse.DataType, deprecated, found, visited)
+					findDeprecatedHeaderTypes(rb.ApiResponse.Headers, deprecated, found, visited)
+				}
+			}
+		}
+
+		names := make([]string, 0, len(found))
+		for n := range found {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			msg := fmt.Sprintf("Api {%s} %s references deprecated type %s", api.Method, api.Path, n)
+			if r := deprecated[n].Deprecated.Replacement; r != "" {
+				msg += fmt.Sprintf(", use %s instead", r)
+			}
+			ret = append(ret, NewParserError(msg, api.Filename, api.Line))
+		}
+	}
+
+	return ret
+}
+
+func findDeprecatedTypes(dt *ApiDataType, deprecated map[string]*ApiDefine, found map[string]bool, visited map[*ApiDataType]bool) {
+	if dt == nil || visited[dt] {
+		return
+	}
+	visited[dt] = true
+
+	for _, n := range []*string{&dt.DataTypeName, dt.ParentType, dt.ItemType, dt.KeyType, dt.ValueType} {
+		if n == nil {
+			continue
+		}
+		if _, ok := deprecated[*n]; ok {
+			found[*n] = true
+		}
+	}
+
+	for _, m := range dt.OneOf {
+		if _, ok := deprecated[m]; ok {
+			found[m] = true
+		}
+	}
+
+	for _, field := range dt.Items {
+		if field.Deprecated == nil {
+			findDeprecatedTypes(field.ApiDataType, deprecated, found, visited)
+		}
+	}
+	findDeprecatedTypes(dt.ElementType, deprecated, found, visited)
+	for _, m := range dt.OneOfTypes {
+		findDeprecatedTypes(m, deprecated, found, visited)
+	}
+	findDeprecatedTypes(dt.KeyDataType, deprecated, found, visited)
+	findDeprecatedTypes(dt.ValueDataType, deprecated, found, visited)
+}
+
+func findDeprecatedHeaderTypes(headers *ApiHeaderList, deprecated map[string]*ApiDefine, found map[string]bool, visited map[*ApiDataType]bool) {
+	if headers == nil {
+		return
+	}
+	for _, hn := range headers.Order {
+		for _, h := range headers.List[hn] {
+			findDeprecatedTypes(h.DataType, deprecated, found, visited)
+		}
+	}
+}
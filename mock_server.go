@@ -0,0 +1,185 @@
+package trapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//
+// Mock server: answers requests with the documented examples
+//
+
+const (
+	// header or query param to select the response status code
+	MOCK_STATUS_HEADER = "X-Mock-Status"
+	MOCK_STATUS_QUERY  = "__status"
+	// header or query param to select the response content type, the Accept header is also used
+	MOCK_CONTENTTYPE_HEADER = "X-Mock-Content-Type"
+	MOCK_CONTENTTYPE_QUERY  = "__content_type"
+)
+
+type MockServer struct {
+	parser  *Parser
+	matcher *apiMatcher
+	synth   *ExampleSynthesizer
+}
+
+func NewMockServer(parser *Parser) *MockServer {
+	return &MockServer{
+		parser:  parser,
+		matcher: newApiMatcher(parser.Apis),
+		synth:   NewExampleSynthesizer(parser, 0),
+	}
+}
+
+func (m *MockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api, _ := m.matcher.match(r.Method, r.URL.Path)
+	if api == nil {
+		m.error(w, http.StatusNotFound, fmt.Sprintf("No api documented for %s %s", r.Method, r.URL.Path))
+		return
+	}
+	if api.Responses == nil || len(api.Responses.List) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// select status code
+	code := r.Header.Get(MOCK_STATUS_HEADER)
+	if code == "" {
+		code = r.URL.Query().Get(MOCK_STATUS_QUERY)
+	}
+	if code == "" {
+		code = m.defaultCode(api)
+	}
+	bodies, ok := api.Responses.List[code]
+	if !ok || len(bodies) == 0 {
+		m.error(w, http.StatusBadRequest, fmt.Sprintf("Status %s not documented for {%s} %s", code, api.Method, api.Path))
+		return
+	}
+
+	// select content type
+	contenttype := r.Header.Get(MOCK_CONTENTTYPE_HEADER)
+	if contenttype == "" {
+		contenttype = r.URL.Query().Get(MOCK_CONTENTTYPE_QUERY)
+	}
+	body := m.selectBody(bodies, contenttype, r.Header.Get("Accept"))
+	if body == nil {
+		m.error(w, http.StatusNotAcceptable, fmt.Sprintf("Content type %s not documented for status %s of {%s} %s", contenttype, code, api.Method, api.Path))
+		return
+	}
+
+	rcontenttype := body.ContentType
+	if rcontenttype == "" || rcontenttype == "-" {
+		rcontenttype = CONTENTTYPE_JSON
+	}
+
+	// response headers
+	if body.ApiResponse.Headers != nil {
+		for _, hn := range body.ApiResponse.Headers.Order {
+			hv := m.synth.value(body.ApiResponse.Headers.List[hn][0].DataType, hn)
+			w.Header().Set(hn, fmt.Sprint(hv))
+		}
+	}
+
+	status, err := strconv.Atoi(code)
+	if err != nil {
+		status = http.StatusOK
+	}
+
+	// documented example
+	if ex := findExample(body.ApiResponse.Examples, rcontenttype); ex != nil {
+		w.Header().Set("Content-Type", rcontenttype)
+		w.WriteHeader(status)
+		w.Write([]byte(ex.Text))
+		return
+	}
+	if body.ApiResponse.DataType != nil {
+		if ex := findExample(body.ApiResponse.DataType.Examples, rcontenttype); ex != nil {
+			w.Header().Set("Content-Type", rcontenttype)
+			w.WriteHeader(status)
+			w.Write([]byte(ex.Text))
+			return
+		}
+	}
+
+	// synthesized example
+	w.Header().Set("Content-Type", rcontenttype)
+	w.WriteHeader(status)
+	if body.ApiResponse.DataType != nil {
+		if ex, err := m.synth.Synthesize(body.ApiResponse.DataType, rcontenttype); err == nil {
+			w.Write([]byte(ex.Text))
+		}
+	}
+}
+
+// defaultCode returns the first success code, or the first code if there is none.
+func (m *MockServer) defaultCode(api *Api) string {
+	codes := make([]string, 0, len(api.Responses.List))
+	for c := range api.Responses.List {
+		codes = append(codes, c)
+	}
+	sort.Strings(codes)
+	for _, c := range codes {
+		for _, rb := range api.Responses.List[c] {
+			if rb.ApiResponse.ResponseType == RESPONSETYPE_SUCCESS {
+				return c
+			}
+		}
+	}
+	return codes[0]
+}
+
+func (m *MockServer) selectBody(bodies []*ApiResponseBody, contenttype string, accept string) *ApiResponseBody {
+	if contenttype != "" {
+		for _, rb := range bodies {
+			if sameMediaType(rb.ContentType, contenttype) {
+				return rb
+			}
+		}
+		return nil
+	}
+	if accept != "" {
+		for _, a := range strings.Split(accept, ",") {
+			for _, rb := range bodies {
+				if sameMediaType(rb.ContentType, a) {
+					return rb
+				}
+			}
+		}
+	}
+	return bodies[0]
+}
+
+func (m *MockServer) error(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": message,
+	})
+}
+
+func findExample(examples []*ApiExample, contenttype string) *ApiExample {
+	mt, _, err := mime.ParseMediaType(contenttype)
+	if err != nil {
+		mt = contenttype
+	}
+	for _, ex := range examples {
+		if sameMediaType(ex.ContentType, mt) {
+			return ex
+		}
+	}
+	// json examples may be declared with a short content type
+	if isJSONContentType(mt) {
+		for _, ex := range examples {
+			if isJSONContentType(ex.ContentType) {
+				return ex
+			}
+		}
+	}
+	return nil
+}
@@ -2,21 +2,35 @@ package trapi
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/RangelReale/gocompar"
 )
 
 type Parser struct {
-	files      []string
-	dirs       []string
-	gcp        *gocompar.Parser
-	apidefload []*SourceParseItemDefine
-	tags []string
-
-	DataTypes  map[string]*ApiDataType
-	ApiDefines []*ApiDefine
-	Apis       []*Api
+	files         []string
+	dirs          []string
+	gcp           *gocompar.Parser
+	apidefload    []*SourceParseItemDefine
+	tags          []string
+	analyzeroutes bool
+	source        *SourceParser
+	groups        map[string]string
+	// version of the item being parsed, to reference the define versions in effect
+	version string
+	// versions of the defines declared in more than one version, in order
+	defineversions map[string][]string
+
+	DataTypes       map[string]*ApiDataType
+	ApiDefines      []*ApiDefine
+	Apis            []*Api
+	SecuritySchemes []*ApiSecurityScheme
+
+	// Mismatches between @api and router registrations, when route analysis is enabled
+	RouteMismatches []*ParserError
 }
 
 func NewParser(gcp *gocompar.Parser) *Parser {
@@ -95,6 +109,12 @@ func (p *Parser) AddTags(tags []string) {
 	p.tags = append(p.tags, tags...)
 }
 
+// SetAnalyzeRoutes enables finding the method and path of annotated handler functions
+// from router registrations.
+func (p *Parser) SetAnalyzeRoutes(analyze bool) {
+	p.analyzeroutes = analyze
+}
+
 func (p *Parser) Parse() error {
 
 	var err error
@@ -117,10 +137,25 @@ func (p *Parser) Parse() error {
 	if err != nil {
 		return err
 	}
+	if p.analyzeroutes {
+		err = sp.AnalyzeRoutes()
+		if err != nil {
+			return err
+		}
+	}
 	return p.ParseSource(sp)
 }
 
 func (p *Parser) ParseSource(sp *SourceParser) error {
+	return p.parseSourceVersion(sp, "", "")
+}
+
+func (p *Parser) parseSourceVersion(sp *SourceParser, minversion string, maxversion string) error {
+
+	// keep the full source for version views
+	p.source = sp
+	sp = sp.filterVersions(minversion, maxversion)
+	p.defineversions = sp.defineVersions()
 
 	// Do multiple passes to load all dependent types
 	for dct := 0; ; dct++ {
@@ -138,7 +173,7 @@ func (p *Parser) ParseSource(sp *SourceParser) error {
 		if ctconv == 0 {
 			miss_def := make([]string, 0)
 			for _, d := range sp.Defines {
-				if _, founddt := p.DataTypes[d.Name]; !founddt {
+				if _, founddt := p.DataTypes[p.defineDataTypeKey(d.Name, d.Version)]; !founddt {
 					miss_def = append(miss_def, d.Name)
 				}
 			}
@@ -153,10 +188,13 @@ func (p *Parser) ParseSource(sp *SourceParser) error {
 		newi := &ApiDefine{
 			DefineType:    srcdefine.DefineType,
 			Name:          srcdefine.Name,
+			Deprecated:    srcdefine.Deprecated,
+			Version:       srcdefine.Version,
 			SPIB_Filename: srcdefine.SPIB_Filename,
 		}
 
 		// parse data type
+		p.version = srcdefine.Version
 		dt, ctmiss, err := p.parseSourceDataType(&srcdefine.SPIB_DataType, nil, false, false)
 		if err != nil {
 			return err
@@ -171,13 +209,71 @@ func (p *Parser) ParseSource(sp *SourceParser) error {
 
 	}
 
+	// load security schemes
+	for _, srcscheme := range sp.SecuritySchemes {
+		newi, err := p.parseSourceSecurityScheme(srcscheme)
+		if err != nil {
+			return err
+		}
+		p.SecuritySchemes = append(p.SecuritySchemes, newi)
+	}
+
+	p.RouteMismatches = sp.RouteMismatches
+	p.groups = make(map[string]string)
+	names := make(map[string]*SourceParseItemApi)
+
 	// load apis
 	for _, srcapi := range sp.Apis {
+		p.version = srcapi.Version
+
+		if srcapi.Method == "" || srcapi.Path == "" {
+			return NewParserError("Could not determine the method and path of api, declare them or enable route analysis", srcapi.Filename, srcapi.Line)
+		}
+
+		// operation ids may only repeat in other versions of the same api
+		if srcapi.Name != "" {
+			if other, ok := names[srcapi.Name]; ok && (!strings.EqualFold(other.Method, srcapi.Method) || other.Path != srcapi.Path || other.Version == srcapi.Version) {
+				return NewParserError(fmt.Sprintf("Api name %s was already used in %s:%d", srcapi.Name, other.Filename, other.Line), srcapi.Filename, srcapi.Line)
+			}
+			names[srcapi.Name] = srcapi
+		}
+
+		for _, req := range srcapi.Security {
+			for _, sec := range req {
+				scheme := p.FindSecurityScheme(sec.Scheme)
+				if scheme == nil {
+					return NewParserError(fmt.Sprintf("Unknown security scheme %s", sec.Scheme), srcapi.Filename, srcapi.Line)
+				}
+				for _, scope := range sec.Scopes {
+					if scheme.Type != SECURITYSCHEME_OAUTH2 {
+						return NewParserError(fmt.Sprintf("Security scheme %s does not support scopes", sec.Scheme), srcapi.Filename, srcapi.Line)
+					}
+					if !scheme.HasScope(scope) {
+						return NewParserError(fmt.Sprintf("Unknown scope %s in security scheme %s", scope, sec.Scheme), srcapi.Filename, srcapi.Line)
+					}
+				}
+			}
+		}
+
+		if srcapi.Group != "" {
+			if gd, ok := p.groups[srcapi.Group]; !ok || gd == "" {
+				p.groups[srcapi.Group] = srcapi.GroupDescription
+			} else if srcapi.GroupDescription != "" && srcapi.GroupDescription != gd {
+				return NewParserError(fmt.Sprintf("Api group %s was already described as '%s'", srcapi.Group, gd), srcapi.Filename, srcapi.Line)
+			}
+		}
 
 		newi := &Api{
 			Method:        srcapi.Method,
 			Path:          srcapi.Path,
 			Description:   srcapi.Description,
+			Handler:       srcapi.Handler,
+			Deprecated:    srcapi.Deprecated,
+			Version:       srcapi.Version,
+			Group:         srcapi.Group,
+			Name:          srcapi.Name,
+			Security:      srcapi.Security,
+			Permissions:   srcapi.Permissions,
 			SPIB_Filename: srcapi.SPIB_Filename,
 		}
 
@@ -201,26 +297,79 @@ func (p *Parser) ParseSource(sp *SourceParser) error {
 				return NewParserError(fmt.Sprintf("Unknown param datatype %s", srcapiparam.DataType), srcapiparam.Filename, srcapiparam.Line)
 			}
 
+			// parse serialization style
+			style, styleok := ParseParamStyle(srcapiparam.Style)
+			if !styleok {
+				return NewParserError(fmt.Sprintf("Unknown style %s of param %s", srcapiparam.Style, srcapiparam.Name), srcapiparam.Filename, srcapiparam.Line)
+			}
+			if style != PARAMSTYLE_DEFAULT && pt != PARAMTYPE_QUERY && pt != PARAMTYPE_FORM {
+				return NewParserError(fmt.Sprintf("Styles are only supported on query and form params, not on %s param %s", srcapiparam.ParamType, srcapiparam.Name), srcapiparam.Filename, srcapiparam.Line)
+			}
+			if (style == PARAMSTYLE_DEEPOBJECT || style == PARAMSTYLE_DOTTED) && dt.DataType != DATATYPE_OBJECT {
+				return NewParserError(fmt.Sprintf("Style %s of param %s requires an object", srcapiparam.Style, srcapiparam.Name), srcapiparam.Filename, srcapiparam.Line)
+			}
+			if (style == PARAMSTYLE_FORM || style == PARAMSTYLE_COMMA) && dt.DataType != DATATYPE_ARRAY && dt.DataType != DATATYPE_OBJECT {
+				return NewParserError(fmt.Sprintf("Style %s of param %s requires an array or object", srcapiparam.Style, srcapiparam.Name), srcapiparam.Filename, srcapiparam.Line)
+			}
+
 			type _dtitem struct {
-				Name     string
-				DataType *ApiDataType
-				Examples []*ApiExample
+				Name       string
+				Required   bool
+				DataType   *ApiDataType
+				Examples   []*ApiExample
+				Deprecated *ApiDeprecated
+				Default    *string
+				Parent     string
 			}
 			dtlist := make([]*_dtitem, 0)
-			if pt == PARAMTYPE_QUERY && dt.DataType == DATATYPE_OBJECT {
-				// expand keys into parameters
-				for _, ppi := range dt.ItemsOrder {
-					if dt.Items[ppi].ApiDataType.DataType == DATATYPE_OBJECT {
-						return NewParserError(fmt.Sprintf("Only one level of indirection is supported in query param %s", srcapiparam.Name), srcapiparam.Filename, srcapiparam.Line)
-					}
+			if (pt == PARAMTYPE_QUERY || pt == PARAMTYPE_FORM || pt == PARAMTYPE_MULTIPART) && dt.DataType == DATATYPE_OBJECT {
+				if srcapiparam.Default != nil {
+					return NewParserError(fmt.Sprintf("Invalid default value of param %s: default values are not supported on objects", srcapiparam.Name), srcapiparam.Filename, srcapiparam.Line)
+				}
+
+				// expand keys into parameters, named by the style
+				var expand func(prefix string, odt *ApiDataType, required bool) error
+				expand = func(prefix string, odt *ApiDataType, required bool) error {
+					for _, ppi := range odt.ItemsOrder {
+						field := odt.Items[ppi]
+						name := field.FieldName
+						switch style {
+						case PARAMSTYLE_DEEPOBJECT:
+							name = prefix + "[" + name + "]"
+						case PARAMSTYLE_DOTTED:
+							name = prefix + "." + name
+						}
+
+						if field.ApiDataType.DataType == DATATYPE_OBJECT {
+							if style != PARAMSTYLE_DEEPOBJECT && style != PARAMSTYLE_DOTTED {
+								return NewParserError(fmt.Sprintf("Only one level of indirection is supported in %s param %s, use the deepObject or dotted style", srcapiparam.ParamType, srcapiparam.Name), srcapiparam.Filename, srcapiparam.Line)
+							}
+							if err := expand(name, field.ApiDataType, required && field.Required); err != nil {
+								return err
+							}
+							continue
+						}
 
-					dtlist = append(dtlist, &_dtitem{dt.Items[ppi].FieldName, dt.Items[ppi].ApiDataType, nil})
+						dtlist = append(dtlist, &_dtitem{name, required && field.Required, field.ApiDataType, nil, field.Deprecated, field.Default, srcapiparam.Name})
+					}
+					return nil
+				}
+				if err := expand(srcapiparam.Name, dt, srcapiparam.Required); err != nil {
+					return err
 				}
 			} else {
 
 				sae := &_dtitem{
-					Name:     srcapiparam.Name,
-					DataType: dt,
+					Name:       srcapiparam.Name,
+					Required:   srcapiparam.Required,
+					DataType:   dt,
+					Deprecated: srcapiparam.Deprecated,
+					Default:    srcapiparam.Default,
+				}
+				if sae.Default != nil {
+					if err := p.checkDefault(*sae.Default, dt); err != nil {
+						return NewParserError(fmt.Sprintf("Invalid default value of param %s: %s", srcapiparam.Name, err.Error()), srcapiparam.Filename, srcapiparam.Line)
+					}
 				}
 				if len(srcapiparam.Examples) > 0 {
 					p.parseApiExampleList(srcapiparam.Examples, &sae.Examples)
@@ -232,8 +381,14 @@ func (p *Parser) ParseSource(sp *SourceParser) error {
 
 				newip := &ApiParam{
 					Name:          procdt.Name,
+					Required:      procdt.Required || pt == PARAMTYPE_URI,
 					DataType:      procdt.DataType,
 					Examples:      procdt.Examples,
+					Deprecated:    procdt.Deprecated,
+					Default:       procdt.Default,
+					ContentTypes:  srcapiparam.ContentTypes,
+					Style:         style,
+					Parent:        procdt.Parent,
 					SPIB_Filename: srcapiparam.SPIB_Filename,
 				}
 
@@ -256,6 +411,88 @@ func (p *Parser) ParseSource(sp *SourceParser) error {
 			}
 		}
 
+		//
+		// Requests
+		//
+		if pl, ok := newi.Params[PARAMTYPE_BODY]; ok && len(pl.Order) > 0 {
+			if len(srcapi.Requests) > 0 {
+				return NewParserError(fmt.Sprintf("Api '%s' cannot mix @apiBody and body params", srcapi.Path), srcapi.Filename, srcapi.Line)
+			}
+
+			if len(pl.Order) > 1 {
+				extra := pl.List[pl.Order[1]]
+				return NewParserError(fmt.Sprintf("Api '%s' has more than one body param: %s", srcapi.Path, strings.Join(pl.Order, ", ")), extra.Filename, extra.Line)
+			}
+
+			// the body param accepts any content type
+			param := pl.List[pl.Order[0]]
+			newi.Requests = &ApiRequestList{
+				List: map[string]*ApiRequestBody{
+					"-": &ApiRequestBody{
+						ContentType: "-",
+						ApiRequest: &ApiRequest{
+							DataType:      param.DataType,
+							Required:      param.Required,
+							Examples:      param.Examples,
+							SPIB_Filename: param.SPIB_Filename,
+						},
+					},
+				},
+				Order: []string{"-"},
+			}
+		}
+		for _, srcapireq := range srcapi.Requests {
+
+			// parse data type
+			dt, ctmiss, err := p.parseSourceDataType(&srcapireq.SPIB_DataType, nil, false, false)
+			if err != nil {
+				return NewParserError(fmt.Sprintf("Error parsing body datatype %s [%s]", srcapireq.DataType, err.Error()), srcapireq.Filename, srcapireq.Line)
+			}
+			if dt == nil || ctmiss > 0 {
+				return NewParserError(fmt.Sprintf("Unknown body datatype %s", srcapireq.DataType), srcapireq.Filename, srcapireq.Line)
+			}
+
+			newireq := &ApiRequest{
+				DataType:      dt,
+				Description:   srcapireq.Description,
+				Required:      true,
+				SPIB_Filename: srcapireq.SPIB_Filename,
+			}
+			if len(srcapireq.Examples) > 0 {
+				p.parseApiExampleList(srcapireq.Examples, &newireq.Examples)
+			}
+
+			if newi.Requests == nil {
+				newi.Requests = &ApiRequestList{
+					List: make(map[string]*ApiRequestBody),
+				}
+			}
+			for _, c_contenttype := range strings.Split(srcapireq.ContentTypes, ",") {
+				if _, fnd := newi.Requests.List[c_contenttype]; fnd {
+					return NewParserError(fmt.Sprintf("Body for content type %s already exists in api '%s'", c_contenttype, srcapi.Path), srcapireq.Filename, srcapireq.Line)
+				}
+				newi.Requests.List[c_contenttype] = &ApiRequestBody{
+					ContentType: c_contenttype,
+					ApiRequest:  newireq,
+				}
+				newi.Requests.Order = append(newi.Requests.Order, c_contenttype)
+			}
+		}
+
+		// only one kind of request body
+		bodykinds := 0
+		if newi.Requests != nil {
+			bodykinds++
+		}
+		for _, pt := range []ParamType{PARAMTYPE_FORM, PARAMTYPE_MULTIPART} {
+			if _, ok := newi.Params[pt]; ok {
+				bodykinds++
+			}
+		}
+		if bodykinds > 1 {
+			return NewParserError(fmt.Sprintf("Api '%s' cannot mix body, form and multipart params", srcapi.Path), srcapi.Filename, srcapi.Line)
+		}
+
 		//
 		// Headers
 		//
@@ -340,6 +577,7 @@ func (p *Parser) ParseSource(sp *SourceParser) error {
 		p.Apis = append(p.Apis, newi)
 
 	}
+	p.version = ""
 
 	return nil
 }
@@ -354,6 +592,129 @@ func (p *Parser) BuildApiList() *ApiList {
 	return ret
 }
 
+func (p *Parser) FindSecurityScheme(name string) *ApiSecurityScheme {
+	for _, s := range p.SecuritySchemes {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func (p *Parser) parseSourceSecurityScheme(srcscheme *SourceParseItemSecurityScheme) (*ApiSecurityScheme, error) {
+
+	if other := p.FindSecurityScheme(srcscheme.Name); other != nil {
+		return nil, NewParserError(fmt.Sprintf("Security scheme %s was already defined in %s:%d", srcscheme.Name, other.Filename, other.Line), srcscheme.Filename, srcscheme.Line)
+	}
+
+	ret := &ApiSecurityScheme{
+		Name:          srcscheme.Name,
+		Type:          ParseSecuritySchemeType(srcscheme.SchemeType),
+		Description:   srcscheme.Description,
+		SPIB_Filename: srcscheme.SPIB_Filename,
+	}
+
+	nopts := 0
+	switch ret.Type {
+	case SECURITYSCHEME_BEARER:
+		// {bearer:format}
+		nopts = 1
+		if len(srcscheme.Options) > 0 {
+			ret.BearerFormat = srcscheme.Options[0]
+		}
+	case SECURITYSCHEME_APIKEY:
+		// {apiKey:in:name}
+		nopts = 2
+		if len(srcscheme.Options) != 2 || srcscheme.Options[1] == "" {
+			return nil, NewParserError(fmt.Sprintf("Security scheme %s must declare where the key is sent, like {apiKey:header:X-API-Key}", srcscheme.Name), srcscheme.Filename, srcscheme.Line)
+		}
+		ret.In, ret.ParamName = srcscheme.Options[0], srcscheme.Options[1]
+		if ret.In != "header" && ret.In != "query" && ret.In != "cookie" {
+			return nil, NewParserError(fmt.Sprintf("Unknown api key location %s in security scheme %s", ret.In, srcscheme.Name), srcscheme.Filename, srcscheme.Line)
+		}
+	case SECURITYSCHEME_OAUTH2:
+		if len(srcscheme.Flows) == 0 {
+			return nil, NewParserError(fmt.Sprintf("Security scheme %s must declare at least one @apiSecurityFlow", srcscheme.Name), srcscheme.Filename, srcscheme.Line)
+		}
+	case SECURITYSCHEME_UNKNOWN:
+		return nil, NewParserError(fmt.Sprintf("Unknown security scheme type %s", srcscheme.SchemeType), srcscheme.Filename, srcscheme.Line)
+	}
+	if len(srcscheme.Options) > nopts {
+		return nil, NewParserError(fmt.Sprintf("Too many options for security scheme %s", srcscheme.Name), srcscheme.Filename, srcscheme.Line)
+	}
+	if ret.Type != SECURITYSCHEME_OAUTH2 && len(srcscheme.Flows) > 0 {
+		return nil, NewParserError(fmt.Sprintf("Security scheme %s does not support flows", srcscheme.Name), srcscheme.Filename, srcscheme.Line)
+	}
+
+	for _, srcflow := range srcscheme.Flows {
+		flow := &ApiSecurityFlow{
+			Flow:   srcflow.Flow,
+			Scopes: make(map[string]string),
+		}
+
+		// urls in the order of the flow, followed by the optional refresh url
+		var urls []*string
+		switch srcflow.Flow {
+		case "implicit":
+			urls = []*string{&flow.AuthorizationUrl}
+		case "password", "clientCredentials":
+			urls = []*string{&flow.TokenUrl}
+		case "authorizationCode":
+			urls = []*string{&flow.AuthorizationUrl, &flow.TokenUrl}
+		default:
+			return nil, NewParserError(fmt.Sprintf("Unknown oauth2 flow %s", srcflow.Flow), srcflow.Filename, srcflow.Line)
+		}
+		if len(srcflow.Urls) < len(urls) || len(srcflow.Urls) > len(urls)+1 {
+			return nil, NewParserError(fmt.Sprintf("Oauth2 flow %s must have %d urls and an optional refresh url", srcflow.Flow, len(urls)), srcflow.Filename, srcflow.Line)
+		}
+		urls = append(urls, &flow.RefreshUrl)
+		for i, u := range srcflow.Urls {
+			*urls[i] = u
+		}
+
+		for _, srcscope := range srcflow.Scopes {
+			if _, ok := flow.Scopes[srcscope.Name]; !ok {
+				flow.ScopesOrder = append(flow.ScopesOrder, srcscope.Name)
+			}
+			flow.Scopes[srcscope.Name] = srcscope.Description
+		}
+
+		ret.Flows = append(ret.Flows, flow)
+	}
+
+	return ret, nil
+}
+
+func (p *Parser) BuildApiGroupList() *ApiGroupList {
+	ret := &ApiGroupList{}
+	var ungrouped *ApiGroup
+	for _, al := range p.Apis {
+		if al.Group == "" {
+			if ungrouped == nil {
+				ungrouped = &ApiGroup{}
+			}
+			ungrouped.Apis = append(ungrouped.Apis, al)
+			continue
+		}
+		g := ret.Find(al.Group)
+		if g == nil {
+			g = &ApiGroup{
+				Name:        al.Group,
+				Description: p.groups[al.Group],
+			}
+			ret.Groups = append(ret.Groups, g)
+		}
+		g.Apis = append(g.Apis, al)
+	}
+	sort.Slice(ret.Groups, func(i, j int) bool {
+		return ret.Groups[i].Name < ret.Groups[j].Name
+	})
+	if ungrouped != nil {
+		ret.Groups = append(ret.Groups, ungrouped)
+	}
+	return ret
+}
+
 func (p *Parser) parseSourceDefinesPass(sp *SourceParser) (ctconv int, ctmiss int, err error) {
 
 	ctconv = 0
@@ -364,16 +725,20 @@ func (p *Parser) parseSourceDefinesPass(sp *SourceParser) (ctconv int, ctmiss in
 
 	for _, d := range sp.Defines {
 
-		if _, founddt := p.DataTypes[d.Name]; founddt {
-			if _, curdef := curdefined[d.Name]; curdef {
+		// defines are referenced in the version they are declared
+		key := p.defineDataTypeKey(d.Name, d.Version)
+		p.version = d.Version
+
+		if _, founddt := p.DataTypes[key]; founddt {
+			if _, curdef := curdefined[key]; curdef {
 				return 0, 0, NewParserError(fmt.Sprintf("Datatype %s was already defined", d.Name), d.Filename, d.Line)
 			}
 			continue
 		}
 
 		// add a temporary datatype to allow recursivity
-		p.DataTypes[d.Name] = &ApiDataType{
-			DataTypeName: d.Name,
+		p.DataTypes[key] = &ApiDataType{
+			DataTypeName: key,
 			DataType:     DATATYPE_NONE,
 			BuiltIn:      false,
 			Override:     false,
@@ -381,7 +746,7 @@ func (p *Parser) parseSourceDefinesPass(sp *SourceParser) (ctconv int, ctmiss in
 
 		dt, pctmiss, err := p.parseSourceDataType(&d.SPIB_DataType, nil, true, true)
 		// delete temporary
-		delete(p.DataTypes, d.Name)
+		delete(p.DataTypes, key)
 		if err != nil {
 			return 0, 0, err
 		}
@@ -390,16 +755,16 @@ func (p *Parser) parseSourceDefinesPass(sp *SourceParser) (ctconv int, ctmiss in
 		// if not found or missed some data type, leave for next pass
 		if dt != nil && pctmiss == 0 {
 			ctconv++
-			p.DataTypes[d.Name] = dt.Clone()
+			p.DataTypes[key] = dt.Clone()
 			// build a list to order by load dependency
 			p.apidefload = append(p.apidefload, d)
 
 			// response examples
 			if len(d.Examples) > 0 {
-				p.parseApiExampleList(d.Examples, &p.DataTypes[d.Name].Examples)
+				p.parseApiExampleList(d.Examples, &p.DataTypes[key].Examples)
 			}
 
-			curdefined[d.Name] = true
+			curdefined[key] = true
 		}
 
 	}
@@ -419,33 +784,52 @@ func (p *Parser) parseSourceDataType(b *SPIB_DataType, rootb *SPIB_DataType, is_
 		rootb = b
 	}
 
-	is_array := false
-	sdt := b.DataType
-	if strings.HasSuffix(sdt, "[]") {
-		is_array = true
-		sdt = strings.TrimSuffix(sdt, "[]")
+	if strings.HasSuffix(b.DataType, "[]") {
+		return p.parseSourceArray(b, rootb, is_checkpass)
 	}
 
-	dt, ok := p.DataTypes[sdt]
-	if ok && is_array {
-		array_parenttype := "Array"
-		a_itemtype := &sdt
-		if dt.DataType == DATATYPE_OBJECT && dt.BuiltIn {
-			a_itemtype = nil
+	sdt := b.DataType
+	dt, ok := p.DataTypes[p.dataTypeKey(sdt, p.version)]
+	if !ok {
+		idt, nmiss, err := p.parseSourceInlineType(sdt, rootb, is_checkpass)
+		if err != nil || nmiss > 0 {
+			return nil, nmiss, err
 		}
-		return &ApiDataType{
-			//Name:         b.Name,
-			DataType:    DATATYPE_ARRAY,
-			ItemType:    a_itemtype,
-			ParentType:  &array_parenttype,
-			Description: b.Description,
-			Override:    true,
-		}, 0, nil
+		dt, ok = idt, idt != nil
+	}
+	if ok && b.Discriminator != nil && dt.DataType != DATATYPE_UNION {
+		return nil, 0, fmt.Errorf("Discriminators are only supported on union data types, not on %s", b.DataType)
+	}
+	if ok && len(b.Enum) > 0 && (dt.DataType == DATATYPE_OBJECT || dt.DataType == DATATYPE_UNION || dt.DataType == DATATYPE_MAP || dt.DataType == DATATYPE_NONE) {
+		return nil, 0, fmt.Errorf("Enum values are not supported on data type %s", b.DataType)
 	}
 
 	if ok && dt.DataType != DATATYPE_OBJECT {
 		ret := dt.Clone()
 		ret.Description = b.Description
+		if b.Nullable {
+			ret.Nullable = true
+		}
+		err := p.parseSourceConstraints(b, ret)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(b.Enum) > 0 {
+			ret.Enum = b.Enum
+			validator := newDataValidator(p, false)
+			for _, ev := range ret.Enum {
+				if verrs := validator.validateString(ret, ev.Value, "enum", ""); len(verrs) > 0 {
+					return nil, 0, fmt.Errorf("Invalid enum value for data type %s: %s", sdt, verrs.Error())
+				}
+			}
+		}
+		if b.Discriminator != nil {
+			err := p.checkDiscriminator(b.Discriminator, ret, is_checkpass)
+			if err != nil {
+				return nil, 0, err
+			}
+			ret.Discriminator = b.Discriminator
+		}
 		if is_define {
 			ret.DataTypeName = b.Name
 			ret.Override = true
@@ -458,6 +842,14 @@ func (p *Parser) parseSourceDataType(b *SPIB_DataType, rootb *SPIB_DataType, is_
 
 		ret := dt.Clone()
 		ret.Description = b.Description
+		if b.Nullable {
+			ret.Nullable = true
+		}
+
+		err := p.parseSourceConstraints(b, ret)
+		if err != nil {
+			return nil, 0, err
+		}
 
 		if !is_define && (b.Items == nil || len(b.Items) == 0) {
 			return ret, 0, nil
@@ -485,10 +877,18 @@ func (p *Parser) parseSourceDataType(b *SPIB_DataType, rootb *SPIB_DataType, is_
 				}
 				ctmiss += newctmiss
 				if newctmiss == 0 {
+					if it.Default != nil {
+						if err := p.checkDefault(*it.Default, newit); err != nil {
+							return nil, 0, fmt.Errorf("Invalid default value of field %s: %s", it.Name, err.Error())
+						}
+					}
 					newifield := &ApiDataTypeField{
 						FieldName:   it.Name,
 						Required:    it.Required,
 						ApiDataType: newit,
+						Deprecated:  it.Deprecated,
+						Default:     it.Default,
+						Nullable:    newit.Nullable,
 					}
 					ret.Items[it.Name] = newifield
 					if !foundi {
@@ -508,3 +908,354 @@ func (p *Parser) parseSourceDataType(b *SPIB_DataType, rootb *SPIB_DataType, is_
 	}
 	return nil, 1, fmt.Errorf("Unknown data type: %s", b.DataType)
 }
+
+// parseSourceArray returns the array of the data type with one less "[]". The constraints,
+// enum values and inline fields of the declaration apply to the innermost elements, except
+// for the items range and nullable marker after the brackets.
+func (p *Parser) parseSourceArray(b *SPIB_DataType, rootb *SPIB_DataType, is_checkpass bool) (*ApiDataType, int, error) {
+	elemb := &SPIB_DataType{
+		Name:          b.Name,
+		DataType:      strings.TrimSuffix(b.DataType, "[]"),
+		Required:      true,
+		Items:         b.Items,
+		Enum:          b.Enum,
+		Range:         b.Range,
+		Pattern:       b.Pattern,
+		Format:        b.Format,
+		Discriminator: b.Discriminator,
+	}
+	if strings.HasSuffix(elemb.DataType, "[]") {
+		elemb.ItemsNullable = b.ItemsNullable
+	} else {
+		elemb.Nullable = b.ItemsNullable
+	}
+
+	edt, ctmiss, err := p.parseSourceDataType(elemb, rootb, false, is_checkpass)
+	if err != nil || edt == nil || ctmiss > 0 {
+		return nil, ctmiss, err
+	}
+
+	array_parenttype := "Array"
+	ret := &ApiDataType{
+		DataType:    DATATYPE_ARRAY,
+		ElementType: edt,
+		ParentType:  &array_parenttype,
+		Description: b.Description,
+		Override:    true,
+		Nullable:    b.Nullable,
+	}
+
+	// named element types are also kept by name
+	if ndt, ok := p.DataTypes[p.dataTypeKey(elemb.DataType, p.version)]; ok && !(ndt.DataType == DATATYPE_OBJECT && ndt.BuiltIn) && len(b.Items) == 0 {
+		a_itemtype := elemb.DataType
+		ret.ItemType = &a_itemtype
+	}
+
+	if b.ItemsRange != "" {
+		min, max, err := parseSourceIntRange(b.ItemsRange)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Invalid items range {%s} of data type %s: %s", b.ItemsRange, b.DataType, err.Error())
+		}
+		ret.MinItems, ret.MaxItems = min, max
+	}
+
+	return ret, 0, nil
+}
+
+// parseSourceInlineType returns the union or map declared inline, or nil for other data
+// types. Inline types are anonymous, they are only kept in the data type that uses them.
+func (p *Parser) parseSourceInlineType(sdt string, rootb *SPIB_DataType, is_checkpass bool) (*ApiDataType, int, error) {
+	// unions of maps are split before matching the map syntax
+	switch {
+	case len(splitSourceTypes(sdt, '|')) > 1:
+		return p.parseSourceUnion(sdt, rootb, is_checkpass)
+	case strings.HasPrefix(sdt, "Map<"):
+		return p.parseSourceMap(sdt, rootb, is_checkpass)
+	}
+	return nil, 0, nil
+}
+
+// parseSourceMemberType parses a member of an inline data type, which may have its own
+// nullable marker, array brackets or inline types.
+func (p *Parser) parseSourceMemberType(name string, sdt string, rootb *SPIB_DataType, is_checkpass bool) (*ApiDataType, int, error) {
+	mb := NewSPIB_DataType(name, sdt, "")
+	return p.parseSourceDataType(&mb, rootb, false, is_checkpass)
+}
+
+var (
+	// Map<KeyType,ValueType>
+	reSourceMap = regexp.MustCompile(`^Map<\s*([^,<>]+?)\s*,\s*(.+?)\s*>$`)
+)
+
+// parseSourceMap returns the map of Map<KeyType,ValueType>. Keys must be strings or
+// integers.
+func (p *Parser) parseSourceMap(sdt string, rootb *SPIB_DataType, is_checkpass bool) (*ApiDataType, int, error) {
+	m := reSourceMap.FindStringSubmatch(sdt)
+	if m == nil {
+		return nil, 0, fmt.Errorf("Invalid map data type %s, expected Map<KeyType,ValueType>", sdt)
+	}
+	keytype, valuetype := m[1], m[2]
+
+	kdt, nmiss, err := p.parseSourceMemberType("key", keytype, rootb, is_checkpass)
+	if err != nil || nmiss > 0 {
+		return nil, nmiss, wrapSourceMemberError(err, "map", sdt)
+	}
+	vdt, nmiss, err := p.parseSourceMemberType("value", valuetype, rootb, is_checkpass)
+	if err != nil || nmiss > 0 {
+		return nil, nmiss, wrapSourceMemberError(err, "map", sdt)
+	}
+
+	rkdt := newDataValidator(p, false).resolve(kdt)
+	if rkdt.DataType != DATATYPE_STRING && rkdt.DataType != DATATYPE_INTEGER && (rkdt.DataType != DATATYPE_NONE || !is_checkpass) {
+		return nil, 0, fmt.Errorf("Keys of map data type %s must be strings or integers", sdt)
+	}
+
+	return &ApiDataType{
+		DataType:      DATATYPE_MAP,
+		KeyType:       &keytype,
+		ValueType:     &valuetype,
+		KeyDataType:   kdt,
+		ValueDataType: vdt,
+		BuiltIn:       true,
+	}, 0, nil
+}
+
+// parseSourceUnion returns the union of the member types separated by "|".
+func (p *Parser) parseSourceUnion(sdt string, rootb *SPIB_DataType, is_checkpass bool) (*ApiDataType, int, error) {
+	ret := &ApiDataType{
+		DataType: DATATYPE_UNION,
+		BuiltIn:  true,
+	}
+	for _, m := range splitSourceTypes(sdt, '|') {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			return nil, 0, fmt.Errorf("Empty member in union data type %s", sdt)
+		}
+		for _, om := range ret.OneOf {
+			if om == m {
+				return nil, 0, fmt.Errorf("Duplicated member %s in union data type %s", m, sdt)
+			}
+		}
+		mdt, nmiss, err := p.parseSourceMemberType("", m, rootb, is_checkpass)
+		if err != nil || nmiss > 0 {
+			return nil, nmiss, wrapSourceMemberError(err, "union", sdt)
+		}
+		ret.OneOf = append(ret.OneOf, m)
+		ret.OneOfTypes = append(ret.OneOfTypes, mdt)
+		// null matches the nullable members
+		if mdt.Nullable {
+			ret.Nullable = true
+		}
+	}
+	if len(ret.OneOf) < 2 {
+		return nil, 0, fmt.Errorf("Union data type %s must have at least two members", sdt)
+	}
+	return ret, 0, nil
+}
+
+// wrapSourceMemberError adds the inline data type to the errors of its members.
+func wrapSourceMemberError(err error, kind string, sdt string) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s in %s data type %s", err.Error(), kind, sdt)
+}
+
+// splitSourceTypes splits a type declaration on the separator, except inside map types.
+func splitSourceTypes(sdt string, sep byte) []string {
+	var ret []string
+	depth, start := 0, 0
+	for i := 0; i < len(sdt); i++ {
+		switch sdt[i] {
+		case '<':
+			depth++
+		case '>':
+			depth--
+		case sep:
+			if depth == 0 {
+				ret = append(ret, sdt[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(ret, sdt[start:])
+}
+
+// checkDiscriminator checks that all the members of the union are objects with the
+// discriminator field, and that the mapping only references members.
+func (p *Parser) checkDiscriminator(disc *ApiDiscriminator, dt *ApiDataType, is_checkpass bool) error {
+	validator := newDataValidator(p, false)
+	for i, m := range dt.OneOf {
+		mdt := validator.resolve(dt.OneOfTypes[i])
+		if mdt == nil || mdt.DataType == DATATYPE_NONE {
+			// recursive reference still being loaded
+			if is_checkpass {
+				continue
+			}
+			return fmt.Errorf("Unknown member %s of union data type %s", m, strings.Join(dt.OneOf, "|"))
+		}
+		if mdt.DataType != DATATYPE_OBJECT {
+			return fmt.Errorf("Discriminator %s requires object members, %s is not an object", disc.Field, m)
+		}
+		if _, ok := mdt.Items[disc.Field]; !ok {
+			return fmt.Errorf("Discriminator field %s is missing in member %s", disc.Field, m)
+		}
+	}
+	for _, v := range disc.MappingOrder {
+		found := false
+		for _, m := range dt.OneOf {
+			if m == disc.Mapping[v] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("Discriminator value %s maps to %s, which is not a member of the union", v, disc.Mapping[v])
+		}
+	}
+	return nil
+}
+
+// checkDefault checks that the default value is valid for the data type. Arrays are
+// comma-separated.
+func (p *Parser) checkDefault(value string, dt *ApiDataType) error {
+	validator := newDataValidator(p, false)
+	rdt := validator.resolve(dt)
+	if rdt == nil || rdt.DataType == DATATYPE_OBJECT || rdt.DataType == DATATYPE_MAP || rdt.DataType == DATATYPE_NONE {
+		return fmt.Errorf("default values are not supported on objects")
+	}
+	if verrs := validator.validateString(rdt, value, "default", ""); len(verrs) > 0 {
+		return verrs
+	}
+	return nil
+}
+
+// parseSourceConstraints sets the constraints declared in the data type syntax according to
+// the kind of data type.
+func (p *Parser) parseSourceConstraints(b *SPIB_DataType, dt *ApiDataType) error {
+
+	switch dt.DataType {
+	case DATATYPE_ARRAY:
+		// inline arrays apply them to their elements
+		if b.Range != "" || b.Pattern != "" || b.Format != "" {
+			return fmt.Errorf("Constraints on the items of array type %s must be declared in its definition", b.DataType)
+		}
+		if b.ItemsRange != "" {
+			min, max, err := parseSourceIntRange(b.ItemsRange)
+			if err != nil {
+				return fmt.Errorf("Invalid items range {%s} of data type %s: %s", b.ItemsRange, b.DataType, err.Error())
+			}
+			dt.MinItems, dt.MaxItems = min, max
+		}
+		return nil
+	case DATATYPE_OBJECT, DATATYPE_UNION, DATATYPE_MAP, DATATYPE_NONE:
+		if b.Range != "" || b.Pattern != "" || b.Format != "" {
+			return fmt.Errorf("Constraints are not supported on data type %s", b.DataType)
+		}
+		return nil
+	}
+
+	if b.Range != "" {
+		switch dt.DataType {
+		case DATATYPE_NUMBER, DATATYPE_INTEGER:
+			min, max, err := splitSourceRange(b.Range)
+			if err == nil && min != "" {
+				dt.Minimum, err = parseSourceRangeNumber(min, dt.DataType)
+			}
+			if err == nil && max != "" {
+				dt.Maximum, err = parseSourceRangeNumber(max, dt.DataType)
+			}
+			if err == nil && dt.Minimum != nil && dt.Maximum != nil && *dt.Minimum > *dt.Maximum {
+				err = fmt.Errorf("minimum is greater than maximum")
+			}
+			if err != nil {
+				return fmt.Errorf("Invalid range {%s} of data type %s: %s", b.Range, b.DataType, err.Error())
+			}
+		case DATATYPE_STRING, DATATYPE_BINARY:
+			min, max, err := parseSourceIntRange(b.Range)
+			if err != nil {
+				return fmt.Errorf("Invalid length range {%s} of data type %s: %s", b.Range, b.DataType, err.Error())
+			}
+			dt.MinLength, dt.MaxLength = min, max
+		default:
+			return fmt.Errorf("Ranges are not supported on data type %s", b.DataType)
+		}
+	}
+
+	if b.Pattern != "" {
+		if dt.DataType != DATATYPE_STRING {
+			return fmt.Errorf("Patterns are only supported on strings, not on data type %s", b.DataType)
+		}
+		re, err := regexp.Compile(b.Pattern)
+		if err != nil {
+			return fmt.Errorf("Invalid pattern /%s/ of data type %s: %s", b.Pattern, b.DataType, err.Error())
+		}
+		dt.Pattern = b.Pattern
+		dt.PatternRegexp = re
+	}
+
+	if b.Format != "" {
+		dt.Format = b.Format
+	}
+
+	return nil
+}
+
+// splitSourceRange splits "min..max" or "min-max", where any side may be empty. A single
+// value is both the minimum and maximum.
+func splitSourceRange(r string) (min string, max string, err error) {
+	if pos := strings.Index(r, ".."); pos >= 0 {
+		min, max = r[:pos], r[pos+2:]
+	} else if pos := strings.Index(r[1:], "-"); pos >= 0 {
+		// a leading "-" is the sign of the minimum
+		min, max = r[:pos+1], r[pos+2:]
+	} else {
+		min, max = r, r
+	}
+	min, max = strings.TrimSpace(min), strings.TrimSpace(max)
+	if min == "" && max == "" {
+		return "", "", fmt.Errorf("empty range")
+	}
+	return min, max, nil
+}
+
+func parseSourceRangeNumber(value string, datatype DataType) (*float64, error) {
+	var f float64
+	var err error
+	if datatype == DATATYPE_INTEGER {
+		var i int64
+		i, err = strconv.ParseInt(value, 10, 64)
+		f = float64(i)
+	} else {
+		f, err = strconv.ParseFloat(value, 64)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid limit '%s'", value)
+	}
+	return &f, nil
+}
+
+// parseSourceIntRange parses a range of lengths or counts.
+func parseSourceIntRange(r string) (min *int, max *int, err error) {
+	smin, smax, err := splitSourceRange(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, l := range []struct {
+		value string
+		out   **int
+	}{{smin, &min}, {smax, &max}} {
+		if l.value == "" {
+			continue
+		}
+		i, err := strconv.Atoi(l.value)
+		if err != nil || i < 0 {
+			return nil, nil, fmt.Errorf("invalid limit '%s'", l.value)
+		}
+		*l.out = &i
+	}
+	if min != nil && max != nil && *min > *max {
+		return nil, nil, fmt.Errorf("minimum is greater than maximum")
+	}
+	return min, max, nil
+}
@@ -1,19 +1,31 @@
 package trapi
 
+import (
+	"fmt"
+)
+
 func (p *Parser) parseApiHeaderList(headers []*SourceParseItemHeader, out *ApiHeaderList) error {
 
 	for _, srcapiheader := range headers {
 
-		// get data type
-		dt, err := p.getDataType(srcapiheader.DataType)
+		// parse data type
+		hdt := NewSPIB_DataType(srcapiheader.Name, srcapiheader.DataType, srcapiheader.Description)
+		if hdt.Default != nil {
+			return NewParserError(fmt.Sprintf("Invalid default value of header %s: default values are not supported on headers", hdt.Name), srcapiheader.Filename, srcapiheader.Line)
+		}
+		dt, ctmiss, err := p.parseSourceDataType(&hdt, nil, false, false)
 		if err != nil {
-			return err
+			return NewParserError(fmt.Sprintf("Error parsing header datatype %s [%s]", srcapiheader.DataType, err.Error()), srcapiheader.Filename, srcapiheader.Line)
+		}
+		if dt == nil || ctmiss > 0 {
+			return NewParserError(fmt.Sprintf("Unknown header datatype %s", srcapiheader.DataType), srcapiheader.Filename, srcapiheader.Line)
 		}
 
 		newih := &ApiHeader{
-			Name:          srcapiheader.Name,
+			Name:          hdt.Name,
 			DataType:      dt,
-			Description:   srcapiheader.Description,
+			Description:   hdt.Description,
+			Required:      hdt.Required,
 			SPIB_Filename: srcapiheader.SPIB_Filename,
 		}
 
@@ -0,0 +1,94 @@
+package trapi
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+//
+// Permission report: the apis requiring each @apiPermission
+//
+
+type PermissionReportItem struct {
+	Name string
+	// descriptions of the permission in the apis, without duplicates
+	Descriptions []string
+	Apis         []*Api
+}
+
+type PermissionReport struct {
+	Permissions []*PermissionReportItem
+	// apis without permissions
+	Unrestricted []*Api
+}
+
+// PermissionReport lists the apis requiring each permission, sorted by permission name.
+func (p *Parser) PermissionReport() *PermissionReport {
+	ret := &PermissionReport{}
+	items := make(map[string]*PermissionReportItem)
+	for _, api := range p.Apis {
+		if len(api.Permissions) == 0 {
+			ret.Unrestricted = append(ret.Unrestricted, api)
+			continue
+		}
+		for _, perm := range api.Permissions {
+			item, ok := items[perm.Name]
+			if !ok {
+				item = &PermissionReportItem{
+					Name: perm.Name,
+				}
+				items[perm.Name] = item
+				ret.Permissions = append(ret.Permissions, item)
+			}
+			if perm.Description != "" && !containsString(item.Descriptions, perm.Description) {
+				item.Descriptions = append(item.Descriptions, perm.Description)
+			}
+			if len(item.Apis) == 0 || item.Apis[len(item.Apis)-1] != api {
+				item.Apis = append(item.Apis, api)
+			}
+		}
+	}
+	sort.Slice(ret.Permissions, func(i, j int) bool {
+		return ret.Permissions[i].Name < ret.Permissions[j].Name
+	})
+	return ret
+}
+
+func (r *PermissionReport) Find(name string) *PermissionReportItem {
+	for _, item := range r.Permissions {
+		if item.Name == name {
+			return item
+		}
+	}
+	return nil
+}
+
+func (r *PermissionReport) String() string {
+	var buf bytes.Buffer
+	for _, item := range r.Permissions {
+		fmt.Fprintf(&buf, "%s\n", item.Name)
+		for _, d := range item.Descriptions {
+			fmt.Fprintf(&buf, "  %s\n", d)
+		}
+		for _, api := range item.Apis {
+			fmt.Fprintf(&buf, "  - {%s} %s\n", api.Method, api.Path)
+		}
+	}
+	if len(r.Unrestricted) > 0 {
+		fmt.Fprintf(&buf, "(no permission)\n")
+		for _, api := range r.Unrestricted {
+			fmt.Fprintf(&buf, "  - {%s} %s\n", api.Method, api.Path)
+		}
+	}
+	return buf.String()
+}
+
+func containsString(list []string, value string) bool {
+	for _, s := range list {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package trapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+//
+// Route coverage: compares documented apis with the routes of a router
+//
+
+type Route struct {
+	Method string
+	Path   string
+}
+
+func (r *Route) String() string {
+	m := r.Method
+	if m == "" {
+		m = "*"
+	}
+	return fmt.Sprintf("{%s} %s", m, r.Path)
+}
+
+// GorillaRoute is implemented by *mux.Route from gorilla/mux.
+type GorillaRoute interface {
+	GetPathTemplate() (string, error)
+	GetMethods() ([]string, error)
+}
+
+type RouteCoverage struct {
+	Routes []*Route
+}
+
+func NewRouteCoverage() *RouteCoverage {
+	return &RouteCoverage{}
+}
+
+// Add adds a router route. An empty method or "*" matches any method.
+func (c *RouteCoverage) Add(method string, path string) {
+	c.Routes = append(c.Routes, &Route{
+		Method: strings.ToUpper(method),
+		Path:   path,
+	})
+}
+
+// ChiWalkFunc can be passed to chi.Walk to add all routes of a chi router.
+func (c *RouteCoverage) ChiWalkFunc(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+	c.Add(method, route)
+	return nil
+}
+
+// AddGorillaRoute adds a route from a gorilla/mux router, to be used inside mux.Router.Walk.
+// Routes without a path template (like subrouter prefixes) are ignored.
+func (c *RouteCoverage) AddGorillaRoute(route GorillaRoute) error {
+	path, err := route.GetPathTemplate()
+	if err != nil {
+		return nil
+	}
+	methods, err := route.GetMethods()
+	if err != nil || len(methods) == 0 {
+		c.Add("", path)
+		return nil
+	}
+	for _, m := range methods {
+		c.Add(m, path)
+	}
+	return nil
+}
+
+type RouteCoverageResult struct {
+	// Router routes without documentation
+	Undocumented []*Route
+	// Documented apis not found in the router
+	Missing []*Api
+}
+
+func (r *RouteCoverageResult) Ok() bool {
+	return len(r.Undocumented) == 0 && len(r.Missing) == 0
+}
+
+// Err returns an error listing all differences, or nil if there are none.
+func (r *RouteCoverageResult) Err() error {
+	if r.Ok() {
+		return nil
+	}
+	return errors.New(r.String())
+}
+
+func (r *RouteCoverageResult) String() string {
+	var lines []string
+	for _, u := range r.Undocumented {
+		lines = append(lines, fmt.Sprintf("Undocumented route %s", u.String()))
+	}
+	for _, m := range r.Missing {
+		lines = append(lines, NewParserError(fmt.Sprintf("Documented api {%s} %s not found in router", m.Method, m.Path), m.Filename, m.Line).Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Check compares the router routes with the parser apis by method and normalized path.
+func (c *RouteCoverage) Check(parser *Parser) *RouteCoverageResult {
+	ret := &RouteCoverageResult{}
+
+	documented := make(map[string]bool)
+	docpaths := make(map[string]bool)
+	for _, api := range parser.Apis {
+		path := NormalizeRoutePath(api.Path)
+		documented[strings.ToUpper(api.Method)+" "+path] = true
+		docpaths[path] = true
+	}
+
+	routed := make(map[string]bool)
+	routepaths := make(map[string]bool)
+	for _, r := range c.Routes {
+		path := NormalizeRoutePath(r.Path)
+		if r.Method == "" || r.Method == "*" {
+			routepaths[path] = true
+			if !docpaths[path] {
+				ret.Undocumented = append(ret.Undocumented, r)
+			}
+			continue
+		}
+		routed[r.Method+" "+path] = true
+		if !documented[r.Method+" "+path] {
+			ret.Undocumented = append(ret.Undocumented, r)
+		}
+	}
+
+	for _, api := range parser.Apis {
+		path := NormalizeRoutePath(api.Path)
+		if !routed[strings.ToUpper(api.Method)+" "+path] && !routepaths[path] {
+			ret.Missing = append(ret.Missing, api)
+		}
+	}
+
+	sort.SliceStable(ret.Undocumented, func(i, j int) bool {
+		if ret.Undocumented[i].Path != ret.Undocumented[j].Path {
+			return ret.Undocumented[i].Path < ret.Undocumented[j].Path
+		}
+		return ret.Undocumented[i].Method < ret.Undocumented[j].Method
+	})
+
+	return ret
+}
+
+var (
+	reRouteParamBrackets = regexp.MustCompile(`<[^>]+>|\{[^}]+\}`)
+	reRouteParamColon    = regexp.MustCompile(`^:[^/]+$`)
+)
+
+// NormalizeRoutePath converts all path param styles (<id>, {id}, {id:regex}, :id) to {}
+// and removes the trailing slash, so paths from different routers can be compared.
+func NormalizeRoutePath(path string) string {
+	segs := strings.Split(path, "/")
+	for i, s := range segs {
+		if reRouteParamColon.MatchString(s) {
+			segs[i] = "{}"
+			continue
+		}
+		segs[i] = reRouteParamBrackets.ReplaceAllString(s, "{}")
+	}
+	ret := strings.Join(segs, "/")
+	if len(ret) > 1 {
+		ret = strings.TrimSuffix(ret, "/")
+	}
+	if !strings.HasPrefix(ret, "/") {
+		ret = "/" + ret
+	}
+	return ret
+}
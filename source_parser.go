@@ -1,15 +1,23 @@
 package trapi
 
 import (
+	"path/filepath"
+
 	"github.com/RangelReale/gocompar"
 )
 
 type SourceParser struct {
-	gcp *gocompar.Parser
+	gcp  *gocompar.Parser
 	tags []string
+	// @apiSecurityDefault by package directory
+	packagesecurity map[string]*sourceSecurityDefault
+
+	Defines         []*SourceParseItemDefine
+	Apis            []*SourceParseItemApi
+	SecuritySchemes []*SourceParseItemSecurityScheme
 
-	Defines []*SourceParseItemDefine
-	Apis    []*SourceParseItemApi
+	Routes          []*SourceRoute
+	RouteMismatches []*ParserError
 }
 
 func NewSourceParser(gcp *gocompar.Parser) *SourceParser {
@@ -42,5 +50,21 @@ func (p *SourceParser) Process() error {
 
 	}
 
-	return nil
+	p.applyPackageSecurity()
+
+	return p.loadGoStructs()
+}
+
+// applyPackageSecurity sets the @apiSecurityDefault of the package on the apis that did not
+// declare @apiSecurity, directly or with a file default.
+func (p *SourceParser) applyPackageSecurity() {
+	for _, a := range p.Apis {
+		if a.SecurityDeclared {
+			continue
+		}
+		if def, ok := p.packagesecurity[filepath.Dir(a.Filename)]; ok {
+			a.Security = def.Security
+			a.SecurityDeclared = true
+		}
+	}
 }
@@ -2,6 +2,7 @@ package trapi
 
 import (
 	"fmt"
+	"path/filepath"
 	"regexp"
 	"strings"
 
@@ -14,7 +15,7 @@ import (
 
 var (
 	// @apiDefine (define_type) {data_type} Name Description
-	reAPIDefine = regexp.MustCompile(`@apiDefine \(([^\)]+)\) \{([^}]+)\} (\S+)(.*)$`)
+	reAPIDefine = regexp.MustCompile(`@apiDefine \(([^\)]+)\) \{((?:[^{}]|\{[^{}]*\})+)\} (\S+)(.*)$`)
 )
 
 func (p *sourceParserFile) parseDefine(line int, comment *gocompar.Comment, text string) error {
@@ -41,6 +42,14 @@ func (p *sourceParserFile) parseDefine(line int, comment *gocompar.Comment, text
 		},
 	}
 
+	// the data type is loaded from a Go struct declaration
+	if newi.DataType == GOSTRUCT_DATATYPE {
+		newi.GoStruct = newi.Name
+		if pos := strings.LastIndex(newi.Name, "."); pos >= 0 {
+			newi.Name = newi.Name[pos+1:]
+		}
+	}
+
 	p.stack.Push(&SourceStackData{
 		ItemType:      SPARSE_ITEM_DEFINE,
 		Item:          newi,
@@ -57,8 +66,10 @@ func (p *sourceParserFile) parseDefine(line int, comment *gocompar.Comment, text
 
 var (
 	// @api {method} path Description
-	reAPIAPI       = regexp.MustCompile(`@api \{([^}]+)\} (\S+)(.*)$`)
-	reAPIAPIParams = regexp.MustCompile(`<([^>]+)>`)
+	reAPIAPI = regexp.MustCompile(`@api \{([^}]+)\} (\S+)(.*)$`)
+	// @api Description (method and path inferred from router registrations)
+	reAPIAPIHandler = regexp.MustCompile(`@api( [^{].*)?$`)
+	reAPIAPIParams  = regexp.MustCompile(`<([^>]+)>`)
 )
 
 func (p *sourceParserFile) parseApi(line int, comment *gocompar.Comment, text string) error {
@@ -71,7 +82,11 @@ func (p *sourceParserFile) parseApi(line int, comment *gocompar.Comment, text st
 
 	s := reAPIAPI.FindStringSubmatch(text)
 	if s == nil || len(s) < 2 {
-		return fmt.Errorf("Could not parse @api line: %s", text)
+		h := reAPIAPIHandler.FindStringSubmatch(text)
+		if h == nil {
+			return fmt.Errorf("Could not parse @api line: %s", text)
+		}
+		s = []string{h[0], "", "", h[1]}
 	}
 
 	//fmt.Printf("@api: {%+v} [[[%s]]]\n", strings.Join(s[1:], ", "), text)
@@ -87,18 +102,7 @@ func (p *sourceParserFile) parseApi(line int, comment *gocompar.Comment, text st
 	}
 
 	// extract params from path
-	params := reAPIAPIParams.FindAllStringSubmatch(newi.Path, -1)
-	for _, pi := range params {
-		newi.Params = append(newi.Params, &SourceParseItemParam{
-			ParamType:     "uri",
-			Name:          pi[1],
-			SPIB_DataType: NewSPIB_DataType("param", "String", ""),
-			SPIB_Filename: SPIB_Filename{
-				Filename: p.filename,
-				Line:     comment.Line + line,
-			},
-		})
-	}
+	newi.addPathParams()
 
 	p.stack.Push(&SourceStackData{
 		ItemType:      SPARSE_ITEM_API,
@@ -115,8 +119,8 @@ func (p *sourceParserFile) parseApi(line int, comment *gocompar.Comment, text st
 //
 
 var (
-	// @apiParam param_type {data_type} Name Description
-	reAPIParam = regexp.MustCompile(`@apiParam (\S+) \{([^}]+)\} (\S+)(.*)$`)
+	// @apiParam param_type[:content_types|:style] {data_type} Name Description
+	reAPIParam = regexp.MustCompile(`@apiParam (\S+) \{((?:[^{}]|\{[^{}]*\})+)\} (\S+)(.*)$`)
 )
 
 func (p *sourceParserFile) parseParam(line int, comment *gocompar.Comment, text string) error {
@@ -138,16 +142,34 @@ func (p *sourceParserFile) parseParam(line int, comment *gocompar.Comment, text
 
 	//fmt.Printf("@apiParam: {%+v} [[[%s]]]\n", strings.Join(s[1:], ", "), text)
 
+	// the name may declare it optional with a default value
+	dt := NewSPIB_DataType(s[3], strings.TrimSpace(s[2]), strings.TrimSpace(s[4]))
+	name := dt.Name
+	dt.Name = "param"
+	if pos := strings.Index(name, "="); pos >= 0 {
+		return fmt.Errorf("Default values require an optional param, declare it as %s?%s or [%s]: %s", name[:pos], name[pos:], name, text)
+	}
+
 	item_param := &SourceParseItemParam{
 		ParamType:     strings.TrimSpace(s[1]),
-		Name:          strings.TrimSuffix(strings.TrimSpace(s[3]), "?"),
-		SPIB_DataType: NewSPIB_DataType("param", strings.TrimSpace(s[2]), strings.TrimSpace(s[4])),
+		Name:          name,
+		SPIB_DataType: dt,
 		SPIB_Filename: SPIB_Filename{
 			Filename: p.filename,
 			Line:     comment.Line + line,
 		},
 	}
 
+	if pos := strings.Index(item_param.ParamType, ":"); pos >= 0 {
+		opt := item_param.ParamType[pos+1:]
+		item_param.ParamType = item_param.ParamType[:pos]
+		if item_param.ParamType == "multipart" {
+			item_param.ContentTypes = strings.Split(opt, ",")
+		} else {
+			item_param.Style = opt
+		}
+	}
+
 	p.stack.Push(&SourceStackData{
 		ItemType:      SPARSE_ITEM_PARAM,
 		Item:          item_param,
@@ -164,7 +186,7 @@ func (p *sourceParserFile) parseParam(line int, comment *gocompar.Comment, text
 
 var (
 	// @api{Success,Error} codes content_types {data_type} Description
-	reAPIResponse = regexp.MustCompile(`@api(\w+) (\S+) (\S+) \{([^}]+)\} (.*)$`)
+	reAPIResponse = regexp.MustCompile(`@api(\w+) (\S+) (\S+) \{((?:[^{}]|\{[^{}]*\})+)\} (.*)$`)
 )
 
 func (p *sourceParserFile) parseResponse(line int, comment *gocompar.Comment, text string) error {
@@ -207,13 +229,60 @@ func (p *sourceParserFile) parseResponse(line int, comment *gocompar.Comment, te
 	return nil
 }
 
+//
+// @api: Body
+//
+
+var (
+	// @apiBody content_types {data_type} Description
+	reAPIBody = regexp.MustCompile(`@apiBody (\S+) \{((?:[^{}]|\{[^{}]*\})+)\}(.*)$`)
+)
+
+func (p *sourceParserFile) parseBody(line int, comment *gocompar.Comment, text string) error {
+
+	// must have an "Api" item at top
+	err := p.stackCloseUntil(SITEM_API)
+	if err != nil {
+		return err
+	}
+
+	if p.stack.Top() == nil || p.stack.Top().ItemType != SPARSE_ITEM_API {
+		return fmt.Errorf("@apiBody must come after an @api: %s", text)
+	}
+
+	s := reAPIBody.FindStringSubmatch(text)
+	if s == nil || len(s) < 2 {
+		return fmt.Errorf("Could not parse @apiBody line: %s", text)
+	}
+
+	//fmt.Printf("@apiBody: {%+v} [[[%s]]]\n", strings.Join(s[1:], ", "), text)
+
+	newi := &SourceParseItemRequest{
+		ContentTypes:  strings.TrimSpace(s[1]),
+		SPIB_DataType: NewSPIB_DataType("body", strings.TrimSpace(s[2]), strings.TrimSpace(s[3])),
+		SPIB_Filename: SPIB_Filename{
+			Filename: p.filename,
+			Line:     comment.Line + line,
+		},
+	}
+
+	p.stack.Push(&SourceStackData{
+		ItemType:      SPARSE_ITEM_REQUEST,
+		Item:          newi,
+		StackItemType: SITEM_DATATYPE,
+		StackItem:     &newi.SPIB_DataType,
+	})
+
+	return nil
+}
+
 //
 // @api: Data
 //
 
 var (
 	// @apiField {data_type} Name Description
-	reAPIField = regexp.MustCompile(`@apiField \{([^}]+)\} (\S+)(.*)$`)
+	reAPIField = regexp.MustCompile(`@apiField \{((?:[^{}]|\{[^{}]*\})+)\} (\S+)(.*)$`)
 )
 
 func (p *sourceParserFile) parseData(line int, comment *gocompar.Comment, text string) error {
@@ -232,27 +301,52 @@ func (p *sourceParserFile) parseData(line int, comment *gocompar.Comment, text s
 
 	datatype := p.stack.Top().StackItem.(*SPIB_DataType)
 
-	sub := strings.Split(s[2], ".")
+	// the default value may contain dots, only the name is split
+	path, defsuffix, optional := s[2], "", false
+	if strings.HasPrefix(path, "[") && strings.HasSuffix(path, "]") {
+		path = strings.TrimSuffix(strings.TrimPrefix(path, "["), "]")
+		optional = true
+	}
+	if pos := strings.Index(path, "="); pos >= 0 {
+		path, defsuffix = path[:pos], path[pos:]
+		if !optional && !strings.HasSuffix(path, "?") {
+			return fmt.Errorf("Default values require an optional field, declare it as %s?%s or [%s%s]: %s", path, defsuffix, path, defsuffix, text)
+		}
+	}
+
+	// fields of arrays of objects are declared as items[].name
+	sub := strings.Split(path, ".")
 	curdt := datatype
 	for subct, subname := range sub {
 		if curdt.Items == nil {
 			curdt.Items = make(SPIB_DataTypeList, 0)
 		}
+		dims := 0
+		for strings.HasSuffix(subname, "[]") {
+			subname = strings.TrimSuffix(subname, "[]")
+			dims++
+		}
 		newi := curdt.Items.Find(subname)
 		if newi == nil {
 			datatype := strings.TrimSpace(s[1])
 			description := strings.TrimSpace(s[3])
+			name := subname
 			if subct < len(sub)-1 {
-				datatype = "Object"
+				datatype = "Object" + strings.Repeat("[]", dims)
 				description = ""
+			} else if optional {
+				name = "[" + subname + defsuffix + "]"
+			} else {
+				name = subname + defsuffix
 			}
 
-			xnewi := NewSPIB_DataType(subname, datatype, description)
+			xnewi := NewSPIB_DataType(name, datatype, description)
 			newi = &xnewi
 			curdt.Items = append(curdt.Items, newi)
 		}
 		curdt = newi
 	}
+	p.lastfield = curdt
 
 	return nil
 }
@@ -309,7 +403,7 @@ func (p *sourceParserFile) parseExample(line int, comment *gocompar.Comment, tex
 
 var (
 	// @apiHeader {data_type} Name Description
-	reAPIHeader = regexp.MustCompile(`@apiHeader \{([^}]+)\} (\S+)(.*)$`)
+	reAPIHeader = regexp.MustCompile(`@apiHeader \{((?:[^{}]|\{[^{}]*\})+)\} (\S+)(.*)$`)
 )
 
 func (p *sourceParserFile) parseHeader(line int, comment *gocompar.Comment, text string) error {
@@ -346,6 +440,488 @@ func (p *sourceParserFile) parseHeader(line int, comment *gocompar.Comment, text
 	return nil
 }
 
+//
+// @api: Deprecated
+//
+
+var (
+	// @apiDeprecated [since] [replacement] Description
+	reAPIDeprecated = regexp.MustCompile(`@apiDeprecated(?: \[([^\]]*)\])?(?: \[([^\]]*)\])?(.*)$`)
+)
+
+func (p *sourceParserFile) parseDeprecated(line int, comment *gocompar.Comment, text string) error {
+
+	s := reAPIDeprecated.FindStringSubmatch(text)
+	if s == nil || len(s) < 2 {
+		return fmt.Errorf("Could not parse @apiDeprecated line: %s", text)
+	}
+
+	//fmt.Printf("@apiDeprecated: {%+v} [[[%s]]]\n", strings.Join(s[1:], ", "), text)
+
+	newi := &ApiDeprecated{
+		Since:       strings.TrimSpace(s[1]),
+		Replacement: strings.TrimSpace(s[2]),
+		Description: strings.TrimSpace(s[3]),
+	}
+
+	// applies to the field declared just before
+	if p.lastfield != nil {
+		p.lastfield.Deprecated = newi
+		return nil
+	}
+
+	// must have an "Api", "Param" or "Define" item at top
+	for p.stack.Len() > 0 {
+		switch p.stack.Top().ItemType {
+		case SPARSE_ITEM_API:
+			p.stack.Top().Item.(*SourceParseItemApi).Deprecated = newi
+			return nil
+		case SPARSE_ITEM_PARAM:
+			p.stack.Top().Item.(*SourceParseItemParam).Deprecated = newi
+			return nil
+		case SPARSE_ITEM_DEFINE:
+			p.stack.Top().Item.(*SourceParseItemDefine).Deprecated = newi
+			return nil
+		case SPARSE_ITEM_RESPONSE:
+			return fmt.Errorf("@apiDeprecated is not supported on responses: %s", text)
+		}
+		err := p.stackCloseLast()
+		if err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("@apiDeprecated must come after an @api, @apiParam, @apiField or @apiDefine: %s", text)
+}
+
+//
+// @api: Enum
+//
+
+var (
+	// @apiEnum value Description
+	reAPIEnum = regexp.MustCompile(`@apiEnum (\S+)(?: (.*))?$`)
+)
+
+func (p *sourceParserFile) parseEnum(line int, comment *gocompar.Comment, text string) error {
+
+	s := reAPIEnum.FindStringSubmatch(text)
+	if s == nil || len(s) < 3 {
+		return fmt.Errorf("Could not parse @apiEnum line: %s", text)
+	}
+
+	//fmt.Printf("@apiEnum: {%+v} [[[%s]]]\n", strings.Join(s[1:], ", "), text)
+
+	// applies to the field declared just before
+	if p.lastfield != nil {
+		p.lastfield.AddEnumValue(s[1], strings.TrimSpace(s[2]))
+		return nil
+	}
+
+	// or to the data type at top
+	if p.stack.Top() == nil || p.stack.Top().StackItemType != SITEM_DATATYPE {
+		return fmt.Errorf("@apiEnum must come after a datatype definition: %s", text)
+	}
+	p.stack.Top().StackItem.(*SPIB_DataType).AddEnumValue(s[1], strings.TrimSpace(s[2]))
+
+	return nil
+}
+
+//
+// @api: Discriminator
+//
+
+var (
+	// @apiDiscriminator field [value=DataType ...]
+	reAPIDiscriminator = regexp.MustCompile(`@apiDiscriminator (\S+)((?:\s+\S+=\S+)*)\s*$`)
+)
+
+func (p *sourceParserFile) parseDiscriminator(line int, comment *gocompar.Comment, text string) error {
+
+	s := reAPIDiscriminator.FindStringSubmatch(text)
+	if s == nil || len(s) < 3 {
+		return fmt.Errorf("Could not parse @apiDiscriminator line: %s", text)
+	}
+
+	//fmt.Printf("@apiDiscriminator: {%+v} [[[%s]]]\n", strings.Join(s[1:], ", "), text)
+
+	disc := &ApiDiscriminator{
+		Field: s[1],
+	}
+	for _, m := range strings.Fields(s[2]) {
+		pos := strings.Index(m, "=")
+		if disc.Mapping == nil {
+			disc.Mapping = make(map[string]string)
+		}
+		if _, ok := disc.Mapping[m[:pos]]; !ok {
+			disc.MappingOrder = append(disc.MappingOrder, m[:pos])
+		}
+		disc.Mapping[m[:pos]] = m[pos+1:]
+	}
+
+	// applies to the field declared just before
+	if p.lastfield != nil {
+		p.lastfield.Discriminator = disc
+		return nil
+	}
+
+	// or to the data type at top
+	if p.stack.Top() == nil || p.stack.Top().StackItemType != SITEM_DATATYPE {
+		return fmt.Errorf("@apiDiscriminator must come after a datatype definition: %s", text)
+	}
+	p.stack.Top().StackItem.(*SPIB_DataType).Discriminator = disc
+
+	return nil
+}
+
+//
+// @api: Version
+//
+
+var (
+	// @apiVersion version
+	reAPIVersion = regexp.MustCompile(`@apiVersion (\S+)\s*$`)
+)
+
+func (p *sourceParserFile) parseVersion(line int, comment *gocompar.Comment, text string) error {
+
+	s := reAPIVersion.FindStringSubmatch(text)
+	if s == nil || len(s) < 2 {
+		return fmt.Errorf("Could not parse @apiVersion line: %s", text)
+	}
+
+	//fmt.Printf("@apiVersion: {%+v} [[[%s]]]\n", strings.Join(s[1:], ", "), text)
+
+	// must have an "Api" or "Define" item at top
+	for p.stack.Len() > 0 {
+		switch p.stack.Top().ItemType {
+		case SPARSE_ITEM_API:
+			p.stack.Top().Item.(*SourceParseItemApi).Version = s[1]
+			return nil
+		case SPARSE_ITEM_DEFINE:
+			p.stack.Top().Item.(*SourceParseItemDefine).Version = s[1]
+			return nil
+		}
+		err := p.stackCloseLast()
+		if err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf("@apiVersion must come after an @api or @apiDefine: %s", text)
+}
+
+//
+// @api: Group
+//
+
+var (
+	// @apiGroup Name Description
+	reAPIGroup = regexp.MustCompile(`@apiGroup (\S+)(?: (.*))?$`)
+)
+
+func (p *sourceParserFile) parseGroup(line int, comment *gocompar.Comment, text string) error {
+
+	s := reAPIGroup.FindStringSubmatch(text)
+	if s == nil || len(s) < 3 {
+		return fmt.Errorf("Could not parse @apiGroup line: %s", text)
+	}
+
+	//fmt.Printf("@apiGroup: {%+v} [[[%s]]]\n", strings.Join(s[1:], ", "), text)
+
+	api, err := p.stackApi()
+	if err != nil {
+		return err
+	}
+	if api == nil {
+		return fmt.Errorf("@apiGroup must come after an @api: %s", text)
+	}
+
+	api.Group = s[1]
+	api.GroupDescription = strings.TrimSpace(s[2])
+
+	return nil
+}
+
+//
+// @api: Name
+//
+
+var (
+	// @apiName operationId
+	reAPIName = regexp.MustCompile(`@apiName ([A-Za-z_][A-Za-z0-9_.\-]*)\s*$`)
+)
+
+func (p *sourceParserFile) parseName(line int, comment *gocompar.Comment, text string) error {
+
+	s := reAPIName.FindStringSubmatch(text)
+	if s == nil || len(s) < 2 {
+		return fmt.Errorf("Could not parse @apiName line: %s", text)
+	}
+
+	//fmt.Printf("@apiName: {%+v} [[[%s]]]\n", strings.Join(s[1:], ", "), text)
+
+	api, err := p.stackApi()
+	if err != nil {
+		return err
+	}
+	if api == nil {
+		return fmt.Errorf("@apiName must come after an @api: %s", text)
+	}
+
+	api.Name = s[1]
+
+	return nil
+}
+
+//
+// @api: Permission
+//
+
+var (
+	// @apiPermission role1,role2 Description
+	reAPIPermission = regexp.MustCompile(`@apiPermission (\S+)(?: (.*))?$`)
+)
+
+func (p *sourceParserFile) parsePermission(line int, comment *gocompar.Comment, text string) error {
+
+	s := reAPIPermission.FindStringSubmatch(text)
+	if s == nil || len(s) < 3 {
+		return fmt.Errorf("Could not parse @apiPermission line: %s", text)
+	}
+
+	//fmt.Printf("@apiPermission: {%+v} [[[%s]]]\n", strings.Join(s[1:], ", "), text)
+
+	api, err := p.stackApi()
+	if err != nil {
+		return err
+	}
+	if api == nil {
+		return fmt.Errorf("@apiPermission must come after an @api: %s", text)
+	}
+
+	for _, name := range strings.Split(s[1], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			api.Permissions = append(api.Permissions, &ApiPermission{
+				Name:        name,
+				Description: strings.TrimSpace(s[2]),
+			})
+		}
+	}
+
+	return nil
+}
+
+// stackApi closes the stack items until the "Api" item, returning nil if there is none.
+func (p *sourceParserFile) stackApi() (*SourceParseItemApi, error) {
+	for p.stack.Len() > 0 {
+		if p.stack.Top().ItemType == SPARSE_ITEM_API {
+			return p.stack.Top().Item.(*SourceParseItemApi), nil
+		}
+		err := p.stackCloseLast()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+//
+// @api: SecurityScheme
+//
+
+var (
+	// @apiSecurityScheme {type:option:option} name Description
+	reAPISecurityScheme = regexp.MustCompile(`@apiSecurityScheme \{(\w+)((?::[^:}]*)*)\} (\S+)(?: (.*))?$`)
+	// @apiSecurityFlow {flow} url url url
+	reAPISecurityFlow = regexp.MustCompile(`@apiSecurityFlow \{(\w+)\}((?: \S+)*)\s*$`)
+	// @apiSecurityScope scope Description
+	reAPISecurityScope = regexp.MustCompile(`@apiSecurityScope (\S+)(?: (.*))?$`)
+)
+
+func (p *sourceParserFile) parseSecurityScheme(line int, comment *gocompar.Comment, text string) error {
+
+	s := reAPISecurityScheme.FindStringSubmatch(text)
+	if s == nil || len(s) < 5 {
+		return fmt.Errorf("Could not parse @apiSecurityScheme line: %s", text)
+	}
+
+	//fmt.Printf("@apiSecurityScheme: {%+v} [[[%s]]]\n", strings.Join(s[1:], ", "), text)
+
+	// closes everything
+	err := p.stackClose()
+	if err != nil {
+		return err
+	}
+
+	newi := &SourceParseItemSecurityScheme{
+		Name:        s[3],
+		SchemeType:  s[1],
+		Description: strings.TrimSpace(s[4]),
+		SPIB_Filename: SPIB_Filename{
+			Filename: p.filename,
+			Line:     comment.Line + line,
+		},
+	}
+	if s[2] != "" {
+		newi.Options = strings.Split(strings.TrimPrefix(s[2], ":"), ":")
+	}
+
+	p.stack.Push(&SourceStackData{
+		ItemType:      SPARSE_ITEM_SECURITYSCHEME,
+		Item:          newi,
+		StackItemType: SITEM_NONE,
+	})
+
+	return nil
+}
+
+func (p *sourceParserFile) parseSecurityFlow(line int, comment *gocompar.Comment, text string) error {
+
+	s := reAPISecurityFlow.FindStringSubmatch(text)
+	if s == nil || len(s) < 3 {
+		return fmt.Errorf("Could not parse @apiSecurityFlow line: %s", text)
+	}
+
+	//fmt.Printf("@apiSecurityFlow: {%+v} [[[%s]]]\n", strings.Join(s[1:], ", "), text)
+
+	if p.stack.Len() == 0 || p.stack.Top().ItemType != SPARSE_ITEM_SECURITYSCHEME {
+		return fmt.Errorf("@apiSecurityFlow must come after an @apiSecurityScheme: %s", text)
+	}
+
+	scheme := p.stack.Top().Item.(*SourceParseItemSecurityScheme)
+	scheme.Flows = append(scheme.Flows, &SourceParseItemSecurityFlow{
+		Flow: s[1],
+		Urls: strings.Fields(s[2]),
+		SPIB_Filename: SPIB_Filename{
+			Filename: p.filename,
+			Line:     comment.Line + line,
+		},
+	})
+
+	return nil
+}
+
+func (p *sourceParserFile) parseSecurityScope(line int, comment *gocompar.Comment, text string) error {
+
+	s := reAPISecurityScope.FindStringSubmatch(text)
+	if s == nil || len(s) < 3 {
+		return fmt.Errorf("Could not parse @apiSecurityScope line: %s", text)
+	}
+
+	//fmt.Printf("@apiSecurityScope: {%+v} [[[%s]]]\n", strings.Join(s[1:], ", "), text)
+
+	if p.stack.Len() == 0 || p.stack.Top().ItemType != SPARSE_ITEM_SECURITYSCHEME || len(p.stack.Top().Item.(*SourceParseItemSecurityScheme).Flows) == 0 {
+		return fmt.Errorf("@apiSecurityScope must come after an @apiSecurityFlow: %s", text)
+	}
+
+	scheme := p.stack.Top().Item.(*SourceParseItemSecurityScheme)
+	flow := scheme.Flows[len(scheme.Flows)-1]
+	flow.Scopes = append(flow.Scopes, &SourceParseItemSecurityScope{
+		Name:        s[1],
+		Description: strings.TrimSpace(s[2]),
+	})
+
+	return nil
+}
+
+//
+// @api: Security
+//
+
+var (
+	// @apiSecurity scheme[scope,scope] scheme
+	// @apiSecurityDefault scheme
+	reAPISecurity = regexp.MustCompile(`@api(Security|SecurityDefault) (.*)$`)
+	// scheme[scope,scope]
+	reAPISecurityItem = regexp.MustCompile(`^([A-Za-z_][\w.\-]*)(?:\[([^\]]*)\])?$`)
+)
+
+func (p *sourceParserFile) parseSecurity(line int, comment *gocompar.Comment, text string) error {
+
+	s := reAPISecurity.FindStringSubmatch(text)
+	if s == nil || len(s) < 3 {
+		return fmt.Errorf("Could not parse @apiSecurity line: %s", text)
+	}
+
+	//fmt.Printf("@apiSecurity: {%+v} [[[%s]]]\n", strings.Join(s[1:], ", "), text)
+
+	// "none" makes the api public, otherwise all schemes in the line are required
+	var req ApiSecurityRequirement
+	if strings.TrimSpace(s[2]) != "none" {
+		for _, item := range strings.Fields(s[2]) {
+			is := reAPISecurityItem.FindStringSubmatch(item)
+			if is == nil {
+				return fmt.Errorf("Could not parse @api%s scheme %s: %s", s[1], item, text)
+			}
+			newi := &ApiSecurity{
+				Scheme: is[1],
+			}
+			for _, scope := range strings.Split(is[2], ",") {
+				if scope = strings.TrimSpace(scope); scope != "" {
+					newi.Scopes = append(newi.Scopes, scope)
+				}
+			}
+			req = append(req, newi)
+		}
+		if len(req) == 0 {
+			return fmt.Errorf("Could not parse @api%s line: %s", s[1], text)
+		}
+	}
+
+	fn := SPIB_Filename{
+		Filename: p.filename,
+		Line:     comment.Line + line,
+	}
+
+	if s[1] == "SecurityDefault" {
+		// package default, must not be inside an api
+		err := p.stackClose()
+		if err != nil {
+			return err
+		}
+		dir := filepath.Dir(p.filename)
+		if p.parser.packagesecurity == nil {
+			p.parser.packagesecurity = make(map[string]*sourceSecurityDefault)
+		}
+		def, ok := p.parser.packagesecurity[dir]
+		if !ok {
+			def = &sourceSecurityDefault{SPIB_Filename: fn}
+			p.parser.packagesecurity[dir] = def
+		} else if def.Filename != fn.Filename {
+			return NewParserError(fmt.Sprintf("@apiSecurityDefault for the package was already declared in %s:%d", def.Filename, def.Line), fn.Filename, fn.Line)
+		}
+		if req != nil {
+			def.Security = append(def.Security, req)
+		}
+		return nil
+	}
+
+	api, err := p.stackApi()
+	if err != nil {
+		return err
+	}
+
+	if api == nil {
+		// file default
+		if p.security == nil {
+			p.security = &sourceSecurityDefault{SPIB_Filename: fn}
+		}
+		if req != nil {
+			p.security.Security = append(p.security.Security, req)
+		}
+		return nil
+	}
+
+	// each line is an alternative
+	api.SecurityDeclared = true
+	if req != nil {
+		api.Security = append(api.Security, req)
+	}
+
+	return nil
+}
+
 //
 // @api: Tag
 //
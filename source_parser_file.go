@@ -18,7 +18,13 @@ type sourceParserFile struct {
 	parser   *SourceParser
 	filename string
 	stack    *SourceParseStack
-	hastags bool
+	hastags  bool
+	// last field declared, for directives that apply to it
+	lastfield *SPIB_DataType
+	// @apiSecurity declared outside an api
+	security *sourceSecurityDefault
+	// index of the first api of the file in the parser
+	firstapi int
 }
 
 func newSourceParserFile(parser *SourceParser, filename string) *sourceParserFile {
@@ -26,6 +32,7 @@ func newSourceParserFile(parser *SourceParser, filename string) *sourceParserFil
 		parser:   parser,
 		filename: filename,
 		stack:    NewSourceParseStack(),
+		firstapi: len(parser.Apis),
 	}
 }
 
@@ -49,6 +56,16 @@ func (p *sourceParserFile) finish() {
 
 	p.stackClose()
 
+	// file default security
+	if p.security != nil {
+		for _, a := range p.parser.Apis[p.firstapi:] {
+			if !a.SecurityDeclared {
+				a.Security = p.security.Security
+				a.SecurityDeclared = true
+			}
+		}
+	}
+
 }
 
 func (p *sourceParserFile) stackClose() error {
@@ -120,6 +137,9 @@ func (p *sourceParserFile) stackCloseLast() error {
 	case SPARSE_ITEM_RESPONSE:
 		api := p.stack.Top().Item.(*SourceParseItemApi)
 		api.Responses = append(api.Responses, i.Item.(*SourceParseItemResponse))
+	case SPARSE_ITEM_REQUEST:
+		api := p.stack.Top().Item.(*SourceParseItemApi)
+		api.Requests = append(api.Requests, i.Item.(*SourceParseItemRequest))
 	case SPARSE_ITEM_EXAMPLE:
 		withexample := p.stack.Top().Item.(ISPIB_WithExamples)
 		e := i.Item.(*SourceParseItemExample)
@@ -127,6 +147,8 @@ func (p *sourceParserFile) stackCloseLast() error {
 			return NewParserError(fmt.Sprintf("Top item does not support examples - cannot add example %s", e.Description), e.Filename, e.Line)
 		}
 		withexample.AppendExample(e)
+	case SPARSE_ITEM_SECURITYSCHEME:
+		p.parser.SecuritySchemes = append(p.parser.SecuritySchemes, i.Item.(*SourceParseItemSecurityScheme))
 	case SPARSE_ITEM_HEADER:
 		withheader := p.stack.Top().Item.(ISPIB_WithHeaders)
 		h := i.Item.(*SourceParseItemHeader)
@@ -179,6 +201,10 @@ func (p *sourceParserFile) parseComment(comment *gocompar.Comment) error {
 		if s != nil && len(s) > 1 {
 			//fmt.Printf("FOUND: [%s] %v\n", p.filename, s)
 
+			if s[1] != "Field" && s[1] != "Deprecated" && s[1] != "Enum" && s[1] != "Discriminator" {
+				p.lastfield = nil
+			}
+
 			var err error
 			switch s[1] {
 			case "Define":
@@ -189,12 +215,36 @@ func (p *sourceParserFile) parseComment(comment *gocompar.Comment) error {
 				err = p.parseParam(line, comment, scan.Text())
 			case "Success", "Error", "Response":
 				err = p.parseResponse(line, comment, scan.Text())
+			case "Body":
+				err = p.parseBody(line, comment, scan.Text())
 			case "Field":
 				err = p.parseData(line, comment, scan.Text())
 			case "Example":
 				err = p.parseExample(line, comment, scan.Text())
 			case "Header":
 				err = p.parseHeader(line, comment, scan.Text())
+			case "Deprecated":
+				err = p.parseDeprecated(line, comment, scan.Text())
+			case "Enum":
+				err = p.parseEnum(line, comment, scan.Text())
+			case "Discriminator":
+				err = p.parseDiscriminator(line, comment, scan.Text())
+			case "Version":
+				err = p.parseVersion(line, comment, scan.Text())
+			case "SecurityScheme":
+				err = p.parseSecurityScheme(line, comment, scan.Text())
+			case "SecurityFlow":
+				err = p.parseSecurityFlow(line, comment, scan.Text())
+			case "SecurityScope":
+				err = p.parseSecurityScope(line, comment, scan.Text())
+			case "Security", "SecurityDefault":
+				err = p.parseSecurity(line, comment, scan.Text())
+			case "Permission":
+				err = p.parsePermission(line, comment, scan.Text())
+			case "Group":
+				err = p.parseGroup(line, comment, scan.Text())
+			case "Name":
+				err = p.parseName(line, comment, scan.Text())
 			case "Ignore":
 				return nil
 			case "IgnoreFile":
@@ -222,6 +272,7 @@ func (p *sourceParserFile) parseComment(comment *gocompar.Comment) error {
 	}
 
 	// each comment block closes the stack
+	p.lastfield = nil
 	err := p.stackClose()
 	if err != nil {
 		return err
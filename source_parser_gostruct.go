@@ -0,0 +1,454 @@
+package trapi
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//
+// GoStruct: builds define data types from Go struct declarations
+//
+// @apiDefine (define_type) {GoStruct} pkg.TypeName Description
+//
+
+const GOSTRUCT_DATATYPE = "GoStruct"
+
+type goStructLoader struct {
+	parser   *SourceParser
+	fset     *token.FileSet
+	importer types.Importer
+	packages map[string]*types.Package
+	files    map[string]bool
+	docs     map[token.Position]string
+	named    map[token.Position]string
+	defined  map[string]SPIB_Filename
+}
+
+func newGoStructLoader(parser *SourceParser) *goStructLoader {
+	fset := token.NewFileSet()
+	ret := &goStructLoader{
+		parser:   parser,
+		fset:     fset,
+		importer: importer.ForCompiler(fset, "source", nil),
+		packages: make(map[string]*types.Package),
+		files:    make(map[string]bool),
+		docs:     make(map[token.Position]string),
+		named:    make(map[token.Position]string),
+		defined:  make(map[string]SPIB_Filename),
+	}
+	for _, d := range parser.Defines {
+		ret.defined[d.Name] = d.SPIB_Filename
+	}
+	return ret
+}
+
+func (p *SourceParser) loadGoStructs() error {
+	var l *goStructLoader
+	var defines []*SourceParseItemDefine
+	var structs []*types.TypeName
+	for _, d := range p.Defines {
+		if d.GoStruct == "" {
+			continue
+		}
+		if l == nil {
+			l = newGoStructLoader(p)
+		}
+		// find all declared structs first, so references use the declared names
+		tn, err := l.lookupDefine(d)
+		if err != nil {
+			return err
+		}
+		if name, ok := l.named[l.fset.Position(tn.Pos())]; ok {
+			return NewParserError(fmt.Sprintf("Go type %s is already declared as %s", d.GoStruct, name), d.Filename, d.Line)
+		}
+		l.named[l.fset.Position(tn.Pos())] = d.Name
+		defines = append(defines, d)
+		structs = append(structs, tn)
+	}
+	for idx, d := range defines {
+		err := l.loadDefine(d, structs[idx])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookupDefine finds the Go struct of a define.
+func (l *goStructLoader) lookupDefine(d *SourceParseItemDefine) (*types.TypeName, error) {
+	pkgname, typename := "", d.GoStruct
+	if pos := strings.LastIndex(d.GoStruct, "."); pos >= 0 {
+		pkgname, typename = d.GoStruct[:pos], d.GoStruct[pos+1:]
+	}
+
+	dir, err := l.resolvePackageDir(d.Filename, pkgname)
+	if err != nil {
+		return nil, NewParserError(err.Error(), d.Filename, d.Line)
+	}
+
+	pkg, err := l.loadPackage(dir)
+	if err != nil {
+		return nil, NewParserError(fmt.Sprintf("Could not load Go package for %s: %s", d.GoStruct, err.Error()), d.Filename, d.Line)
+	}
+
+	tn, ok := pkg.Scope().Lookup(typename).(*types.TypeName)
+	if !ok {
+		return nil, NewParserError(fmt.Sprintf("Go type %s not found", d.GoStruct), d.Filename, d.Line)
+	}
+	if _, ok := tn.Type().Underlying().(*types.Struct); !ok {
+		return nil, NewParserError(fmt.Sprintf("Go type %s is not a struct", d.GoStruct), d.Filename, d.Line)
+	}
+	return tn, nil
+}
+
+func (l *goStructLoader) loadDefine(d *SourceParseItemDefine, tn *types.TypeName) error {
+	st := tn.Type().Underlying().(*types.Struct)
+
+	if d.Description == "" {
+		doc, err := l.doc(tn.Pos())
+		if err != nil {
+			return NewParserError(fmt.Sprintf("Error loading Go type %s: %s", d.GoStruct, err.Error()), d.Filename, d.Line)
+		}
+		d.Description = doc
+	}
+
+	// fields declared with @apiField override the ones from the struct
+	declared := d.Items
+	d.DataType, d.Items = "Object", nil
+	err := l.loadStruct(&d.SPIB_DataType, st, d.DefineType)
+	if err != nil {
+		return NewParserError(fmt.Sprintf("Error loading Go type %s: %s", d.GoStruct, err.Error()), d.Filename, d.Line)
+	}
+	for _, it := range declared {
+		replaced := false
+		for idx, sit := range d.Items {
+			if sit.Name == it.Name {
+				d.Items[idx] = it
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			d.Items = append(d.Items, it)
+		}
+	}
+
+	return nil
+}
+
+func (l *goStructLoader) resolvePackageDir(filename string, pkgname string) (string, error) {
+	filedir := filepath.Dir(filename)
+
+	f, err := parser.ParseFile(token.NewFileSet(), filename, nil, parser.ImportsOnly)
+	if err != nil {
+		return "", err
+	}
+	if pkgname == "" || pkgname == f.Name.Name {
+		return filedir, nil
+	}
+
+	for _, imp := range f.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+		if imp.Name != nil {
+			if imp.Name.Name == pkgname {
+				return l.importDir(path, filedir)
+			}
+			continue
+		}
+		if path == pkgname || filepath.Base(path) == pkgname {
+			return l.importDir(path, filedir)
+		}
+		if bp, err := build.Import(path, filedir, build.FindOnly|build.IgnoreVendor); err == nil && bp.Name == pkgname {
+			return bp.Dir, nil
+		}
+	}
+
+	return "", fmt.Errorf("Could not find Go package %s imported from %s", pkgname, filename)
+}
+
+func (l *goStructLoader) importDir(path string, srcdir string) (string, error) {
+	bp, err := build.Import(path, srcdir, build.FindOnly)
+	if err != nil {
+		return "", err
+	}
+	return bp.Dir, nil
+}
+
+func (l *goStructLoader) loadPackage(dir string) (*types.Package, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if pkg, ok := l.packages[dir]; ok {
+		return pkg, nil
+	}
+
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*ast.File
+	for _, fn := range bp.GoFiles {
+		f, err := l.parseFile(filepath.Join(dir, fn))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	// type errors unrelated to the requested structs are ignored
+	conf := types.Config{
+		Importer: l.importer,
+		Error:    func(err error) {},
+	}
+	pkg, _ := conf.Check(bp.ImportPath, l.fset, files, nil)
+
+	l.packages[dir] = pkg
+	return pkg, nil
+}
+
+// parseFile parses a Go source file, collecting the doc comments of its types and fields.
+func (l *goStructLoader) parseFile(filename string) (*ast.File, error) {
+	f, err := parser.ParseFile(l.fset, filename, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	l.files[filename] = true
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.GenDecl:
+			for _, spec := range x.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok {
+					l.docs[l.fset.Position(ts.Name.Pos())] = goStructDoc(ts.Doc, x.Doc, ts.Comment)
+				}
+			}
+		case *ast.Field:
+			doc := goStructDoc(x.Doc, x.Comment)
+			for _, n := range x.Names {
+				l.docs[l.fset.Position(n.Pos())] = doc
+			}
+			if len(x.Names) == 0 {
+				l.docs[l.fset.Position(x.Type.Pos())] = doc
+			}
+		}
+		return true
+	})
+
+	return f, nil
+}
+
+// doc returns the doc comment of a type or field, parsing its source file if needed.
+// Docs are keyed by file position, so they match objects loaded by the importer too.
+func (l *goStructLoader) doc(pos token.Pos) (string, error) {
+	position := l.fset.Position(pos)
+	if position.Filename == "" {
+		return "", nil
+	}
+	if !l.files[position.Filename] {
+		if _, err := l.parseFile(position.Filename); err != nil {
+			return "", err
+		}
+	}
+	return l.docs[position], nil
+}
+
+func goStructDoc(groups ...*ast.CommentGroup) string {
+	for _, g := range groups {
+		if g != nil {
+			if t := strings.TrimSpace(g.Text()); t != "" {
+				return strings.Join(strings.Fields(t), " ")
+			}
+		}
+	}
+	return ""
+}
+
+func (l *goStructLoader) loadStruct(dt *SPIB_DataType, st *types.Struct, definetype string) error {
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		if !field.Exported() && !field.Embedded() {
+			continue
+		}
+
+		name := field.Name()
+		required := true
+		tag := reflect.StructTag(st.Tag(i)).Get("json")
+		if tag == "-" {
+			continue
+		}
+		if tag != "" {
+			opts := strings.Split(tag, ",")
+			if opts[0] != "" {
+				name = opts[0]
+			}
+			for _, o := range opts[1:] {
+				if o == "omitempty" {
+					required = false
+				}
+			}
+		}
+
+		if field.Embedded() && (tag == "" || strings.HasPrefix(tag, ",")) {
+			ft := field.Type()
+			if ptr, ok := ft.(*types.Pointer); ok {
+				ft = ptr.Elem()
+			}
+			if est, ok := ft.Underlying().(*types.Struct); ok {
+				// the first embedded struct becomes the parent type, the others are flattened
+				if dt.DataType == "Object" && len(dt.Items) == 0 {
+					if named, ok := ft.(*types.Named); ok {
+						pname, err := l.namedDataType(named, definetype)
+						if err != nil {
+							return err
+						}
+						dt.DataType = pname
+						continue
+					}
+				}
+				err := l.loadStruct(dt, est, definetype)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if !field.Exported() {
+				continue
+			}
+		}
+
+		fdt, err := l.fieldDataType(field.Type(), definetype)
+		if err != nil {
+			return fmt.Errorf("field %s: %s", field.Name(), err.Error())
+		}
+
+		doc, err := l.doc(field.Pos())
+		if err != nil {
+			return err
+		}
+		newi := NewSPIB_DataType(name, fdt, doc)
+		newi.Required = required
+		if fst, ok := derefType(field.Type()).(*types.Struct); ok {
+			newi.DataType = "Object"
+			err := l.loadStruct(&newi, fst, definetype)
+			if err != nil {
+				return err
+			}
+		}
+		dt.Items = append(dt.Items, &newi)
+	}
+	return nil
+}
+
+func derefType(t types.Type) types.Type {
+	if ptr, ok := t.(*types.Pointer); ok {
+		return ptr.Elem()
+	}
+	return t
+}
+
+func (l *goStructLoader) fieldDataType(t types.Type, definetype string) (string, error) {
+	t = derefType(t)
+
+	if named, ok := t.(*types.Named); ok {
+		obj := named.Obj()
+		if obj.Pkg() != nil && obj.Pkg().Path() == "time" && obj.Name() == "Time" {
+			return "DateTime", nil
+		}
+		if obj.Pkg() != nil && obj.Pkg().Path() == "encoding/json" && obj.Name() == "RawMessage" {
+			return "Object", nil
+		}
+		if _, ok := named.Underlying().(*types.Struct); ok {
+			return l.namedDataType(named, definetype)
+		}
+	}
+
+	switch x := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case x.Info()&types.IsBoolean != 0:
+			return "Boolean", nil
+		case x.Info()&types.IsInteger != 0:
+			return "Integer", nil
+		case x.Info()&types.IsFloat != 0:
+			return "Number", nil
+		case x.Info()&types.IsString != 0:
+			return "String", nil
+		}
+	case *types.Slice:
+		if b, ok := x.Elem().(*types.Basic); ok && b.Kind() == types.Byte {
+			return "Binary", nil
+		}
+		return l.arrayDataType(x.Elem(), definetype)
+	case *types.Array:
+		return l.arrayDataType(x.Elem(), definetype)
+	case *types.Struct, *types.Map, *types.Interface:
+		return "Object", nil
+	}
+
+	return "", fmt.Errorf("unsupported Go type %s", t.String())
+}
+
+func (l *goStructLoader) arrayDataType(elem types.Type, definetype string) (string, error) {
+	edt, err := l.fieldDataType(elem, definetype)
+	if err != nil {
+		return "", err
+	}
+	return edt + "[]", nil
+}
+
+// namedDataType returns the define name of a named struct, creating a define for it if
+// it was not declared in the sources.
+func (l *goStructLoader) namedDataType(named *types.Named, definetype string) (string, error) {
+	// structs are keyed by position, as packages loaded by the importer have their own objects
+	obj := named.Obj()
+	if name, ok := l.named[l.fset.Position(obj.Pos())]; ok {
+		return name, nil
+	}
+
+	// names already used by structs of other packages or by hand-written defines are
+	// qualified by the package name
+	name := obj.Name()
+	if _, ok := l.defined[name]; ok && obj.Pkg() != nil {
+		name = obj.Pkg().Name() + "." + name
+	}
+	if prev, ok := l.defined[name]; ok {
+		return "", fmt.Errorf("Go type %s conflicts with the define %s [%s:%d]", name, name, prev.Filename, prev.Line)
+	}
+	pos := l.fset.Position(obj.Pos())
+	l.named[pos] = name
+
+	doc, err := l.doc(obj.Pos())
+	if err != nil {
+		return "", err
+	}
+	newi := &SourceParseItemDefine{
+		DefineType:    definetype,
+		SPIB_DataType: NewSPIB_DataType(name, "Object", doc),
+		SPIB_Filename: SPIB_Filename{
+			Filename: pos.Filename,
+			Line:     pos.Line,
+		},
+	}
+	l.defined[name] = newi.SPIB_Filename
+	err = l.loadStruct(&newi.SPIB_DataType, named.Underlying().(*types.Struct), definetype)
+	if err != nil {
+		return "", err
+	}
+	l.parser.Defines = append(l.parser.Defines, newi)
+
+	return name, nil
+}
@@ -9,6 +9,8 @@ const (
 	SPARSE_ITEM_RESPONSE
 	SPARSE_ITEM_EXAMPLE
 	SPARSE_ITEM_HEADER
+	SPARSE_ITEM_SECURITYSCHEME
+	SPARSE_ITEM_REQUEST
 )
 
 func (sp SourceParseItemType) String() string {
@@ -25,6 +27,10 @@ func (sp SourceParseItemType) String() string {
 		return "SPARSE_ITEM_EXAMPLE"
 	case SPARSE_ITEM_HEADER:
 		return "SPARSE_ITEM_HEADER"
+	case SPARSE_ITEM_SECURITYSCHEME:
+		return "SPARSE_ITEM_SECURITYSCHEME"
+	case SPARSE_ITEM_REQUEST:
+		return "SPARSE_ITEM_REQUEST"
 	}
 	return "SPARSE_ITEM_UNKNOWN"
 }
@@ -38,9 +44,21 @@ type SourceParseItemApi struct {
 	Method      string
 	Path        string
 	Description string
+	Handler     string
+	Deprecated  *ApiDeprecated
+	Version     string
+	Group       string
+	// group description, may be declared in any of the group apis
+	GroupDescription string
+	Name             string
+	// set when @apiSecurity was declared, even if to make the api public
+	SecurityDeclared bool
+	Security         []ApiSecurityRequirement
+	Permissions      []*ApiPermission
 
 	Params    []*SourceParseItemParam
 	Headers   []*SourceParseItemHeader
+	Requests  []*SourceParseItemRequest
 	Responses []*SourceParseItemResponse
 }
 
@@ -59,10 +77,49 @@ func (a *SourceParseItemApi) AddParam(param *SourceParseItemParam) {
 	a.Params = append(a.Params, param)
 }
 
+// addPathParams adds the params found in the path as uri params, if not declared yet.
+func (a *SourceParseItemApi) addPathParams() {
+	params := reAPIAPIParams.FindAllStringSubmatch(a.Path, -1)
+	for _, pi := range params {
+		found := false
+		for _, p := range a.Params {
+			if p.ParamType == "uri" && p.Name == pi[1] {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		a.Params = append(a.Params, &SourceParseItemParam{
+			ParamType:     "uri",
+			Name:          pi[1],
+			SPIB_DataType: NewSPIB_DataType("param", "String", ""),
+			SPIB_Filename: a.SPIB_Filename,
+		})
+	}
+}
+
 func (a *SourceParseItemApi) AppendHeader(header *SourceParseItemHeader) {
 	a.Headers = append(a.Headers, header)
 }
 
+//
+// Source Parse Item: REQUEST
+//
+type SourceParseItemRequest struct {
+	SPIB_Filename
+	SPIB_DataType
+
+	ContentTypes string
+
+	Examples []*SourceParseItemExample
+}
+
+func (pr *SourceParseItemRequest) AppendExample(example *SourceParseItemExample) {
+	pr.Examples = append(pr.Examples, example)
+}
+
 //
 // Source Parse Item: RESPONSE
 //
@@ -95,6 +152,10 @@ type SourceParseItemParam struct {
 
 	ParamType string
 	Name      string
+	// content types of multipart parts, declared as multipart:type1,type2
+	ContentTypes []string
+	// serialization style, declared as query:style
+	Style string
 
 	Examples []*SourceParseItemExample
 }
@@ -111,6 +172,8 @@ type SourceParseItemDefine struct {
 	SPIB_DataType
 
 	DefineType string
+	GoStruct   string
+	Version    string
 	Examples   []*SourceParseItemExample
 }
 
@@ -139,3 +202,36 @@ type SourceParseItemExample struct {
 	ContentType string
 	Description string
 }
+
+//
+// Source Parse Item: SECURITY SCHEME
+//
+type SourceParseItemSecurityScheme struct {
+	SPIB_Filename
+
+	Name        string
+	SchemeType  string
+	Options     []string
+	Description string
+	Flows       []*SourceParseItemSecurityFlow
+}
+
+type SourceParseItemSecurityFlow struct {
+	SPIB_Filename
+
+	Flow   string
+	Urls   []string
+	Scopes []*SourceParseItemSecurityScope
+}
+
+type SourceParseItemSecurityScope struct {
+	Name        string
+	Description string
+}
+
+// sourceSecurityDefault is a default @apiSecurity for the apis of a file or package.
+type sourceSecurityDefault struct {
+	SPIB_Filename
+
+	Security []ApiSecurityRequirement
+}
@@ -1,6 +1,7 @@
 package trapi
 
 import (
+	"regexp"
 	"strings"
 )
 
@@ -15,25 +16,101 @@ type SPIB_DataType struct {
 	Description string
 	Required    bool
 	Items       SPIB_DataTypeList
+	Deprecated  *ApiDeprecated
+	Enum        []*ApiEnumValue
+	// constraints, resolved according to the data type
+	Range      string
+	ItemsRange string
+	Pattern    string
+	Format     string
+	// default value of optional items
+	Default *string
+	// discriminator of union types
+	Discriminator *ApiDiscriminator
+	// null values are accepted, for the array items with ItemsNullable
+	Nullable      bool
+	ItemsNullable bool
 }
 
+var (
+	// Type?{range}[][]?{items_range}~/pattern/:format=enum1,enum2
+	reSPIBDataType = regexp.MustCompile(`^([^{}\[\]~:=?]+)(\?)?(?:\{([^{}]*)\})?((?:\[\])*)(\?)?(?:\{([^{}]*)\})?(?:~/(.*)/)?(?::([\w\-]+))?(?:=(.*))?$`)
+)
+
 func NewSPIB_DataType(name string, datatype string, description string) SPIB_DataType {
 	name = strings.TrimSpace(name)
 	datatype = strings.TrimSpace(datatype)
 	description = strings.TrimSpace(description)
 	required := true
 
+	// name?=default, [name=default] or [name]
+	var defvalue *string
+	if strings.HasPrefix(name, "[") && strings.HasSuffix(name, "]") {
+		required = false
+		name = strings.TrimSuffix(strings.TrimPrefix(name, "["), "]")
+		if pos := strings.Index(name, "="); pos >= 0 {
+			dv := name[pos+1:]
+			defvalue = &dv
+			name = name[:pos]
+		}
+	} else if pos := strings.Index(name, "?="); pos >= 0 {
+		required = false
+		dv := name[pos+2:]
+		defvalue = &dv
+		name = name[:pos]
+	}
+
 	if strings.HasSuffix(name, "?") {
 		required = false
 		name = strings.TrimSuffix(name, "?")
 	}
 
-	return SPIB_DataType{
+	ret := SPIB_DataType{
 		Name:        name,
 		DataType:    datatype,
 		Description: description,
 		Required:    required,
+		Default:     defvalue,
+	}
+
+	// unknown syntax is kept in the data type, to be reported as unknown
+	m := reSPIBDataType.FindStringSubmatch(datatype)
+	if m == nil {
+		return ret
+	}
+
+	ret.DataType = strings.TrimSpace(m[1]) + m[4]
+	ret.Range = strings.TrimSpace(m[3])
+	ret.ItemsRange = strings.TrimSpace(m[6])
+	ret.Pattern = m[7]
+	ret.Format = m[8]
+	// the marker after the type name applies to the innermost items of arrays
+	if m[4] != "" {
+		ret.ItemsNullable = m[2] != ""
+		ret.Nullable = m[5] != ""
+	} else {
+		ret.Nullable = m[2] != "" || m[5] != ""
+	}
+	if m[9] != "" {
+		for _, ev := range strings.Split(m[9], ",") {
+			if ev = strings.TrimSpace(ev); ev != "" {
+				ret.Enum = append(ret.Enum, &ApiEnumValue{Value: ev})
+			}
+		}
+	}
+
+	return ret
+}
+
+// AddEnumValue adds an allowed value, or sets the description of an existing one.
+func (d *SPIB_DataType) AddEnumValue(value string, description string) {
+	for _, ev := range d.Enum {
+		if ev.Value == value {
+			ev.Description = description
+			return
+		}
 	}
+	d.Enum = append(d.Enum, &ApiEnumValue{Value: value, Description: description})
 }
 
 type SPIB_Text struct {
@@ -0,0 +1,522 @@
+package trapi
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//
+// Router analysis: associates annotated handler functions with router registrations
+//
+// Supports net/http (HandleFunc/Handle, including Go 1.22 "METHOD /path" patterns),
+// gorilla/mux (HandleFunc(...).Methods(...), PathPrefix(...).Subrouter()) and
+// chi (Get/Post/..., Method/MethodFunc, Route).
+//
+
+type SourceRoute struct {
+	Method string
+	Path   string
+	// handler function as pkg.Func or method as pkg.Type.Method, empty if the package or
+	// receiver type could not be determined
+	Handler string
+	// bare function or method name
+	HandlerName   string
+	HandlerMethod bool
+
+	SPIB_Filename
+}
+
+var (
+	chiRouteMethods = map[string]string{
+		"Get":     "GET",
+		"Post":    "POST",
+		"Put":     "PUT",
+		"Patch":   "PATCH",
+		"Delete":  "DELETE",
+		"Head":    "HEAD",
+		"Options": "OPTIONS",
+		"Connect": "CONNECT",
+		"Trace":   "TRACE",
+	}
+	reRouterParam = regexp.MustCompile(`\{([^}:.]+)(?:[:.][^}]*)?\}`)
+)
+
+// AnalyzeRoutes finds router registrations in the Go packages of the parsed files and
+// fills the method and path of handler apis that omit them.
+func (p *SourceParser) AnalyzeRoutes() error {
+
+	fset := token.NewFileSet()
+	files := make(map[string]*ast.File)
+
+	dirs := make(map[string]bool)
+	for _, f := range p.gcp.Comments {
+		dirs[filepath.Dir(f.Filename)] = true
+	}
+	dirlist := make([]string, 0, len(dirs))
+	for d := range dirs {
+		dirlist = append(dirlist, d)
+	}
+	sort.Strings(dirlist)
+
+	for _, d := range dirlist {
+		pkgs, err := parser.ParseDir(fset, d, func(fi os.FileInfo) bool {
+			return !strings.HasSuffix(fi.Name(), "_test.go")
+		}, parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		for _, pkg := range pkgs {
+			for fn, f := range pkg.Files {
+				files[filepath.Clean(fn)] = f
+			}
+		}
+	}
+
+	filenames := make([]string, 0, len(files))
+	for fn := range files {
+		filenames = append(filenames, fn)
+	}
+	sort.Strings(filenames)
+
+	// result types of the functions of all packages, to find the type of receivers
+	// created by constructors
+	funcresults := make(map[string]string)
+	for _, fn := range filenames {
+		f := files[fn]
+		ra := newRouteAnalyzer(fset, f, nil)
+		for _, decl := range f.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv == nil && fd.Type.Results != nil && len(fd.Type.Results.List) > 0 {
+				if t := ra.typeName(fd.Type.Results.List[0].Type); t != "" {
+					funcresults[f.Name.Name+"."+fd.Name.Name] = t
+				}
+			}
+		}
+	}
+
+	// find the routes registered in all files
+	p.Routes = nil
+	for _, fn := range filenames {
+		ra := newRouteAnalyzer(fset, files[fn], funcresults)
+		ast.Inspect(files[fn], ra.inspect)
+		p.Routes = append(p.Routes, ra.routes...)
+	}
+
+	// associate apis with their handler functions
+	handlernames := make(map[string]string)
+	handlercount := make(map[string]int)
+	for _, api := range p.Apis {
+		f, ok := files[filepath.Clean(api.Filename)]
+		if !ok {
+			continue
+		}
+		for _, decl := range f.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Doc == nil {
+				continue
+			}
+			if fset.Position(fd.Doc.Pos()).Line <= api.Line && fset.Position(fd.Doc.End()).Line >= api.Line {
+				api.Handler = f.Name.Name + "." + fd.Name.Name
+				bare := fd.Name.Name
+				if fd.Recv != nil && len(fd.Recv.List) > 0 {
+					api.Handler = newRouteAnalyzer(fset, f, nil).typeName(fd.Recv.List[0].Type) + "." + fd.Name.Name
+					bare = "." + bare
+				}
+				handlernames[api.Handler] = bare
+				handlercount[bare]++
+				break
+			}
+		}
+	}
+
+	for _, api := range p.Apis {
+		if api.Handler == "" {
+			continue
+		}
+
+		var routes []*SourceRoute
+		for _, r := range p.Routes {
+			if r.Handler == api.Handler {
+				routes = append(routes, r)
+			}
+		}
+
+		// registrations with unknown receiver types are matched by name, if no other api
+		// handler has the same name
+		ambiguous := false
+		if len(routes) == 0 {
+			bare := handlernames[api.Handler]
+			for _, r := range p.Routes {
+				if r.Handler == "" && (r.HandlerMethod == strings.HasPrefix(bare, ".")) && r.HandlerName == strings.TrimPrefix(bare, ".") {
+					routes = append(routes, r)
+				}
+			}
+			ambiguous = len(routes) > 0 && handlercount[bare] > 1
+		}
+		if len(routes) == 0 {
+			continue
+		}
+
+		if ambiguous {
+			if api.Method == "" && api.Path == "" {
+				p.RouteMismatches = append(p.RouteMismatches, NewParserError(fmt.Sprintf("Handler %s of api matches the ambiguous router registration {%s} %s [%s:%d], declare the method and path",
+					api.Handler, routes[0].Method, routes[0].Path, routes[0].Filename, routes[0].Line), api.Filename, api.Line))
+			}
+			continue
+		}
+
+		if api.Method == "" && api.Path == "" {
+			// registrations without method accept any, documented as get
+			api.Method = strings.ToLower(routes[0].Method)
+			if api.Method == "" {
+				api.Method = "get"
+			}
+			api.Path = routes[0].Path
+			api.addPathParams()
+			continue
+		}
+
+		found := false
+		for _, r := range routes {
+			if routeMatches(api, r) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			p.RouteMismatches = append(p.RouteMismatches, NewParserError(fmt.Sprintf("Api {%s} %s does not match router registration {%s} %s of handler %s [%s:%d]",
+				api.Method, api.Path, routes[0].Method, routes[0].Path, api.Handler, routes[0].Filename, routes[0].Line), api.Filename, api.Line))
+		}
+	}
+
+	return nil
+}
+
+func routeMatches(api *SourceParseItemApi, r *SourceRoute) bool {
+	if r.Method != "" && !strings.EqualFold(api.Method, r.Method) {
+		return false
+	}
+	return api.Path == r.Path
+}
+
+// normalizeRouterPath converts router path parameters to the <param> format.
+func normalizeRouterPath(path string) string {
+	return reRouterParam.ReplaceAllString(path, "<$1>")
+}
+
+type routeAnalyzer struct {
+	fset     *token.FileSet
+	prefixes map[*ast.Object]string
+	visited  map[*ast.CallExpr]bool
+	routes   []*SourceRoute
+	// package of the file and names of its imports
+	pkg         string
+	imports     map[string]string
+	funcresults map[string]string
+}
+
+func newRouteAnalyzer(fset *token.FileSet, f *ast.File, funcresults map[string]string) *routeAnalyzer {
+	ret := &routeAnalyzer{
+		fset:        fset,
+		prefixes:    make(map[*ast.Object]string),
+		visited:     make(map[*ast.CallExpr]bool),
+		pkg:         f.Name.Name,
+		imports:     make(map[string]string),
+		funcresults: funcresults,
+	}
+	for _, is := range f.Imports {
+		ipath, err := strconv.Unquote(is.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := path.Base(ipath)
+		alias := name
+		if is.Name != nil {
+			alias = is.Name.Name
+		}
+		ret.imports[alias] = name
+	}
+	return ret
+}
+
+func (a *routeAnalyzer) inspect(n ast.Node) bool {
+	switch x := n.(type) {
+	case *ast.AssignStmt:
+		// sub := r.PathPrefix("/prefix").Subrouter()
+		if len(x.Lhs) == 1 && len(x.Rhs) == 1 {
+			if id, ok := x.Lhs[0].(*ast.Ident); ok && id.Obj != nil {
+				if prefix, ok := a.subrouterPrefix(x.Rhs[0]); ok {
+					a.prefixes[id.Obj] = prefix
+				}
+			}
+		}
+	case *ast.CallExpr:
+		if a.visited[x] {
+			return true
+		}
+		a.analyzeCall(x)
+	}
+	return true
+}
+
+func (a *routeAnalyzer) subrouterPrefix(e ast.Expr) (string, bool) {
+	call, ok := e.(*ast.CallExpr)
+	if !ok {
+		return "", false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != "Subrouter" {
+		return "", false
+	}
+	inner, ok := sel.X.(*ast.CallExpr)
+	if !ok {
+		return "", false
+	}
+	isel, ok := inner.Fun.(*ast.SelectorExpr)
+	if !ok || isel.Sel.Name != "PathPrefix" || len(inner.Args) != 1 {
+		return "", false
+	}
+	prefix, ok := stringLiteral(inner.Args[0])
+	if !ok {
+		return "", false
+	}
+	return a.prefixOf(isel.X) + prefix, true
+}
+
+func (a *routeAnalyzer) prefixOf(e ast.Expr) string {
+	if id, ok := e.(*ast.Ident); ok && id.Obj != nil {
+		return a.prefixes[id.Obj]
+	}
+	return ""
+}
+
+func (a *routeAnalyzer) analyzeCall(call *ast.CallExpr) {
+
+	// walk the call chain: r.HandleFunc("/path", h).Methods("GET")
+	var methods []string
+	var path string
+	var handler *routeHandler
+	haspath := false
+	var recv ast.Expr
+
+	cur := call
+	for cur != nil {
+		a.visited[cur] = true
+		sel, ok := cur.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return
+		}
+
+		switch sel.Sel.Name {
+		case "Methods":
+			for _, arg := range cur.Args {
+				if m, ok := stringLiteral(arg); ok {
+					methods = append(methods, strings.ToUpper(m))
+				}
+			}
+		case "Path":
+			if len(cur.Args) == 1 {
+				path, haspath = stringLiteral(cur.Args[0])
+			}
+		case "HandlerFunc", "Handler":
+			if len(cur.Args) == 1 {
+				handler = a.handler(cur.Args[0])
+			}
+		case "HandleFunc", "Handle":
+			if len(cur.Args) == 2 {
+				path, haspath = stringLiteral(cur.Args[0])
+				handler = a.handler(cur.Args[1])
+				// Go 1.22 patterns: "GET /path"
+				if pos := strings.Index(path, " "); haspath && pos > 0 {
+					methods = append(methods, strings.ToUpper(path[:pos]))
+					path = strings.TrimSpace(path[pos+1:])
+				}
+			}
+		case "Method", "MethodFunc":
+			if len(cur.Args) == 3 {
+				if m, ok := stringLiteral(cur.Args[0]); ok {
+					methods = append(methods, strings.ToUpper(m))
+				}
+				path, haspath = stringLiteral(cur.Args[1])
+				handler = a.handler(cur.Args[2])
+			}
+		case "Route":
+			// r.Route("/prefix", func(r chi.Router) { ... })
+			if len(cur.Args) == 2 {
+				if prefix, ok := stringLiteral(cur.Args[0]); ok {
+					if fl, ok := cur.Args[1].(*ast.FuncLit); ok && len(fl.Type.Params.List) == 1 && len(fl.Type.Params.List[0].Names) == 1 {
+						if pobj := fl.Type.Params.List[0].Names[0].Obj; pobj != nil {
+							a.prefixes[pobj] = a.prefixOf(sel.X) + prefix
+						}
+					}
+				}
+			}
+			return
+		default:
+			if m, ok := chiRouteMethods[sel.Sel.Name]; ok && len(cur.Args) == 2 {
+				methods = append(methods, m)
+				path, haspath = stringLiteral(cur.Args[0])
+				handler = a.handler(cur.Args[1])
+			}
+		}
+
+		recv = sel.X
+		cur, _ = sel.X.(*ast.CallExpr)
+	}
+
+	if !haspath || handler == nil || !strings.HasPrefix(path, "/") {
+		return
+	}
+
+	path = normalizeRouterPath(a.prefixOf(recv) + path)
+	pos := a.fset.Position(call.Pos())
+	if len(methods) == 0 {
+		methods = append(methods, "")
+	}
+	for _, m := range methods {
+		a.routes = append(a.routes, &SourceRoute{
+			Method:        m,
+			Path:          path,
+			Handler:       handler.key,
+			HandlerName:   handler.name,
+			HandlerMethod: handler.method,
+			SPIB_Filename: SPIB_Filename{
+				Filename: pos.Filename,
+				Line:     pos.Line,
+			},
+		})
+	}
+}
+
+func stringLiteral(e ast.Expr) (string, bool) {
+	lit, ok := e.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		return "", false
+	}
+	return s, true
+}
+
+type routeHandler struct {
+	key    string
+	name   string
+	method bool
+}
+
+// handler returns the function or method of a handler expression. The key is empty if the
+// receiver type could not be determined.
+func (a *routeAnalyzer) handler(e ast.Expr) *routeHandler {
+	switch x := e.(type) {
+	case *ast.Ident:
+		// functions, variables holding handlers are not followed
+		if x.Obj != nil && x.Obj.Kind != ast.Fun {
+			return &routeHandler{name: x.Name}
+		}
+		return &routeHandler{key: a.pkg + "." + x.Name, name: x.Name}
+	case *ast.SelectorExpr:
+		if id, ok := x.X.(*ast.Ident); ok && id.Obj == nil {
+			if pkg, ok := a.imports[id.Name]; ok {
+				return &routeHandler{key: pkg + "." + x.Sel.Name, name: x.Sel.Name}
+			}
+		}
+		ret := &routeHandler{name: x.Sel.Name, method: true}
+		if t := a.exprType(x.X); t != "" {
+			ret.key = t + "." + x.Sel.Name
+		}
+		return ret
+	case *ast.CallExpr:
+		// http.HandlerFunc(h)
+		if len(x.Args) == 1 {
+			return a.handler(x.Args[0])
+		}
+	}
+	return nil
+}
+
+// exprType returns the type of a receiver variable as pkg.Type, or an empty string.
+func (a *routeAnalyzer) exprType(e ast.Expr) string {
+	id, ok := e.(*ast.Ident)
+	if !ok || id.Obj == nil {
+		return ""
+	}
+	switch d := id.Obj.Decl.(type) {
+	case *ast.Field:
+		return a.typeName(d.Type)
+	case *ast.ValueSpec:
+		if d.Type != nil {
+			return a.typeName(d.Type)
+		}
+		for i, n := range d.Names {
+			if n.Obj == id.Obj && i < len(d.Values) {
+				return a.valueType(d.Values[i])
+			}
+		}
+	case *ast.AssignStmt:
+		if len(d.Lhs) != len(d.Rhs) {
+			return ""
+		}
+		for i, l := range d.Lhs {
+			if lid, ok := l.(*ast.Ident); ok && lid.Obj == id.Obj {
+				return a.valueType(d.Rhs[i])
+			}
+		}
+	}
+	return ""
+}
+
+// valueType returns the type of values like &Type{}, Type{}, new(Type) or NewType().
+func (a *routeAnalyzer) valueType(e ast.Expr) string {
+	switch x := e.(type) {
+	case *ast.UnaryExpr:
+		return a.valueType(x.X)
+	case *ast.CompositeLit:
+		return a.typeName(x.Type)
+	case *ast.CallExpr:
+		switch fn := x.Fun.(type) {
+		case *ast.Ident:
+			if fn.Name == "new" && len(x.Args) == 1 {
+				return a.typeName(x.Args[0])
+			}
+			return a.funcresults[a.pkg+"."+fn.Name]
+		case *ast.SelectorExpr:
+			if id, ok := fn.X.(*ast.Ident); ok {
+				if pkg, ok := a.imports[id.Name]; ok {
+					return a.funcresults[pkg+"."+fn.Sel.Name]
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// typeName returns a type expression as pkg.Type, without pointers or type parameters.
+func (a *routeAnalyzer) typeName(e ast.Expr) string {
+	switch x := e.(type) {
+	case *ast.StarExpr:
+		return a.typeName(x.X)
+	case *ast.IndexExpr:
+		return a.typeName(x.X)
+	case *ast.IndexListExpr:
+		return a.typeName(x.X)
+	case *ast.Ident:
+		return a.pkg + "." + x.Name
+	case *ast.SelectorExpr:
+		if id, ok := x.X.(*ast.Ident); ok {
+			if pkg, ok := a.imports[id.Name]; ok {
+				return pkg + "." + x.Sel.Name
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,519 @@
+package trapi
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+//
+// Validation of values against api data types
+//
+
+const (
+	DATE_FORMAT     = "2006-01-02"
+	TIME_FORMAT     = "15:04:05"
+	DATETIME_FORMAT = time.RFC3339
+)
+
+type ValidationError struct {
+	Location string `json:"location"`
+	Name     string `json:"name"`
+	Message  string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("%s: %s", e.Location, e.Message)
+	}
+	return fmt.Sprintf("%s %s: %s", e.Location, e.Name, e.Message)
+}
+
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, ve := range e {
+		msgs = append(msgs, ve.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type dataValidator struct {
+	parser *Parser
+	// report fields not declared in the data type
+	strict bool
+}
+
+func newDataValidator(parser *Parser, strict bool) *dataValidator {
+	return &dataValidator{
+		parser: parser,
+		strict: strict,
+	}
+}
+
+// resolve returns the full data type of recursive references and array items.
+func (v *dataValidator) resolve(dt *ApiDataType) *ApiDataType {
+	if dt != nil && dt.DataType == DATATYPE_NONE && dt.DataTypeName != "" {
+		if rdt, ok := v.parser.DataTypes[dt.DataTypeName]; ok {
+			return rdt
+		}
+	}
+	return dt
+}
+
+// itemType returns the data type of the array items, or nil if any item is accepted.
+// Element types are not resolved, to keep their nullable marker.
+func (v *dataValidator) itemType(dt *ApiDataType) *ApiDataType {
+	if dt.ElementType != nil {
+		return dt.ElementType
+	}
+	if dt.ItemType == nil {
+		return nil
+	}
+	return v.resolve(v.parser.DataTypes[*dt.ItemType])
+}
+
+// validateString validates a value received as text, like uri and query params or headers.
+func (v *dataValidator) validateString(dt *ApiDataType, value string, location string, name string) ValidationErrors {
+	dt = v.resolve(dt)
+	if dt == nil {
+		return nil
+	}
+
+	var msg string
+	switch dt.DataType {
+	case DATATYPE_INTEGER:
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			msg = fmt.Sprintf("invalid integer '%s'", value)
+		}
+	case DATATYPE_NUMBER:
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			msg = fmt.Sprintf("invalid number '%s'", value)
+		}
+	case DATATYPE_BOOLEAN:
+		if _, err := strconv.ParseBool(value); err != nil {
+			msg = fmt.Sprintf("invalid boolean '%s'", value)
+		}
+	case DATATYPE_DATE, DATATYPE_TIME, DATATYPE_DATETIME:
+		msg = validateDateString(dt.DataType, value)
+	case DATATYPE_UNION:
+		// text cannot be discriminated, any member is accepted
+		for _, m := range dt.OneOfTypes {
+			if len(v.validateString(m, value, location, name)) == 0 {
+				return nil
+			}
+		}
+		msg = fmt.Sprintf("value '%s' does not match any of %s", value, strings.Join(dt.OneOf, ", "))
+	case DATATYPE_ARRAY:
+		items := strings.Split(value, ",")
+		if value == "" {
+			items = nil
+		}
+		if msg := v.constraintMessage(dt, len(items)); msg != "" {
+			return ValidationErrors{{Location: location, Name: name, Message: msg}}
+		}
+		var ret ValidationErrors
+		if it := v.itemType(dt); it != nil {
+			for idx, item := range items {
+				ret = append(ret, v.validateString(it, item, location, fmt.Sprintf("%s[%d]", name, idx))...)
+			}
+		}
+		return ret
+	}
+
+	if msg == "" && len(dt.Enum) > 0 && !enumContains(dt, value) {
+		msg = enumMessage(dt, value)
+	}
+	if msg == "" {
+		if dt.DataType == DATATYPE_NUMBER || dt.DataType == DATATYPE_INTEGER {
+			f, _ := strconv.ParseFloat(value, 64)
+			msg = v.constraintMessage(dt, f)
+		} else {
+			msg = v.constraintMessage(dt, value)
+		}
+	}
+
+	if msg != "" {
+		return ValidationErrors{{Location: location, Name: name, Message: msg}}
+	}
+	return nil
+}
+
+// validateStrings validates the repeated values of an exploded array, like ids=1&ids=2.
+func (v *dataValidator) validateStrings(dt *ApiDataType, values []string, location string, name string) ValidationErrors {
+	dt = v.resolve(dt)
+	if dt == nil {
+		return nil
+	}
+	if msg := v.constraintMessage(dt, len(values)); msg != "" {
+		return ValidationErrors{{Location: location, Name: name, Message: msg}}
+	}
+	var ret ValidationErrors
+	if it := v.itemType(dt); it != nil {
+		for idx, item := range values {
+			ret = append(ret, v.validateString(it, item, location, fmt.Sprintf("%s[%d]", name, idx))...)
+		}
+	}
+	return ret
+}
+
+// enumContains returns whether the value is one of the allowed values. Numbers and booleans
+// are compared by value.
+func enumContains(dt *ApiDataType, value interface{}) bool {
+	// values received as text
+	if s, ok := value.(string); ok {
+		switch dt.DataType {
+		case DATATYPE_NUMBER, DATATYPE_INTEGER:
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				value = f
+			}
+		case DATATYPE_BOOLEAN:
+			if b, err := strconv.ParseBool(s); err == nil {
+				value = b
+			}
+		}
+	}
+
+	for _, ev := range dt.Enum {
+		switch v := value.(type) {
+		case string:
+			if v == ev.Value {
+				return true
+			}
+		case float64:
+			if ef, err := strconv.ParseFloat(ev.Value, 64); err == nil && ef == v {
+				return true
+			}
+		case bool:
+			if eb, err := strconv.ParseBool(ev.Value); err == nil && eb == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func enumMessage(dt *ApiDataType, value interface{}) string {
+	values := make([]string, 0, len(dt.Enum))
+	for _, ev := range dt.Enum {
+		values = append(values, ev.Value)
+	}
+	return fmt.Sprintf("value '%v' is not one of [%s]", value, strings.Join(values, ", "))
+}
+
+func validateDateString(datatype DataType, value string) string {
+	var err error
+	switch datatype {
+	case DATATYPE_DATE:
+		_, err = time.Parse(DATE_FORMAT, value)
+		if err != nil {
+			return fmt.Sprintf("invalid date '%s', expected format YYYY-MM-DD", value)
+		}
+	case DATATYPE_TIME:
+		_, err = time.Parse(TIME_FORMAT, value)
+		if err != nil {
+			return fmt.Sprintf("invalid time '%s', expected format HH:MM:SS", value)
+		}
+	case DATATYPE_DATETIME:
+		_, err = time.Parse(DATETIME_FORMAT, value)
+		if err != nil {
+			return fmt.Sprintf("invalid datetime '%s', expected RFC3339 format", value)
+		}
+	}
+	return ""
+}
+
+// validateValue validates a value decoded from JSON.
+func (v *dataValidator) validateValue(dt *ApiDataType, value interface{}, location string, name string) ValidationErrors {
+	// references may be nullable without the referenced type being
+	nullable := dt != nil && dt.Nullable
+	dt = v.resolve(dt)
+	if dt == nil {
+		return nil
+	}
+
+	verr := func(format string, args ...interface{}) ValidationErrors {
+		return ValidationErrors{{Location: location, Name: name, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	if value == nil {
+		if nullable || dt.Nullable {
+			return nil
+		}
+		return verr("null value")
+	}
+
+	if dt.DataType == DATATYPE_UNION {
+		return v.validateUnion(dt, value, location, name)
+	}
+
+	switch dt.DataType {
+	case DATATYPE_STRING, DATATYPE_BINARY:
+		if _, ok := value.(string); !ok {
+			return verr("expected string, got %s", jsonTypeName(value))
+		}
+	case DATATYPE_DATE, DATATYPE_TIME, DATATYPE_DATETIME:
+		s, ok := value.(string)
+		if !ok {
+			return verr("expected string, got %s", jsonTypeName(value))
+		}
+		if msg := validateDateString(dt.DataType, s); msg != "" {
+			return verr("%s", msg)
+		}
+	case DATATYPE_NUMBER:
+		if _, ok := value.(float64); !ok {
+			return verr("expected number, got %s", jsonTypeName(value))
+		}
+	case DATATYPE_INTEGER:
+		f, ok := value.(float64)
+		if !ok {
+			return verr("expected integer, got %s", jsonTypeName(value))
+		}
+		if f != math.Trunc(f) {
+			return verr("expected integer, got %v", f)
+		}
+	case DATATYPE_BOOLEAN:
+		if _, ok := value.(bool); !ok {
+			return verr("expected boolean, got %s", jsonTypeName(value))
+		}
+	}
+
+	if len(dt.Enum) > 0 && !enumContains(dt, value) {
+		return verr("%s", enumMessage(dt, value))
+	}
+
+	switch dt.DataType {
+	case DATATYPE_ARRAY:
+		a, ok := value.([]interface{})
+		if !ok {
+			return verr("expected array, got %s", jsonTypeName(value))
+		}
+		if msg := v.constraintMessage(dt, len(a)); msg != "" {
+			return verr("%s", msg)
+		}
+		var ret ValidationErrors
+		if it := v.itemType(dt); it != nil {
+			for idx, item := range a {
+				ret = append(ret, v.validateValue(it, item, location, fmt.Sprintf("%s[%d]", name, idx))...)
+			}
+		}
+		return ret
+	case DATATYPE_OBJECT:
+		o, ok := value.(map[string]interface{})
+		if !ok {
+			return verr("expected object, got %s", jsonTypeName(value))
+		}
+		return v.validateObject(dt, o, location, name)
+	case DATATYPE_MAP:
+		o, ok := value.(map[string]interface{})
+		if !ok {
+			return verr("expected object, got %s", jsonTypeName(value))
+		}
+		return v.validateMap(dt, o, location, name)
+	}
+
+	if msg := v.constraintMessage(dt, value); msg != "" {
+		return verr("%s", msg)
+	}
+
+	return nil
+}
+
+// validateUnion validates the value against the member named by the discriminator, or
+// checks that it matches exactly one of the members.
+func (v *dataValidator) validateUnion(dt *ApiDataType, value interface{}, location string, name string) ValidationErrors {
+	if dt.Discriminator != nil {
+		o, ok := value.(map[string]interface{})
+		if !ok {
+			return ValidationErrors{{Location: location, Name: name, Message: fmt.Sprintf("expected object, got %s", jsonTypeName(value))}}
+		}
+		field := joinFieldName(name, dt.Discriminator.Field)
+		dv, ok := o[dt.Discriminator.Field]
+		if !ok || dv == nil {
+			return ValidationErrors{{Location: location, Name: field, Message: "required discriminator missing"}}
+		}
+		m := dt.Discriminator.DataTypeName(fmt.Sprint(dv))
+		for i, om := range dt.OneOf {
+			if om == m {
+				return v.validateValue(dt.OneOfTypes[i], value, location, name)
+			}
+		}
+		return ValidationErrors{{Location: location, Name: field, Message: fmt.Sprintf("unknown discriminator value '%v'", dv)}}
+	}
+
+	var matches []string
+	for i, m := range dt.OneOf {
+		if len(v.validateValue(dt.OneOfTypes[i], value, location, name)) == 0 {
+			matches = append(matches, m)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return ValidationErrors{{Location: location, Name: name, Message: fmt.Sprintf("value does not match any of %s", strings.Join(dt.OneOf, ", "))}}
+	case 1:
+		return nil
+	}
+	return ValidationErrors{{Location: location, Name: name, Message: fmt.Sprintf("value matches more than one of %s", strings.Join(matches, ", "))}}
+}
+
+var reValidateUUID = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// constraintMessage checks the constraints of the data type. The value is a float64 for
+// numbers, a string for strings and the item count for arrays.
+func (v *dataValidator) constraintMessage(dt *ApiDataType, value interface{}) string {
+	switch x := value.(type) {
+	case float64:
+		if dt.Minimum != nil && x < *dt.Minimum {
+			return fmt.Sprintf("value %v is less than the minimum %v", x, *dt.Minimum)
+		}
+		if dt.Maximum != nil && x > *dt.Maximum {
+			return fmt.Sprintf("value %v is greater than the maximum %v", x, *dt.Maximum)
+		}
+	case int:
+		if dt.MinItems != nil && x < *dt.MinItems {
+			return fmt.Sprintf("%d items, expected at least %d", x, *dt.MinItems)
+		}
+		if dt.MaxItems != nil && x > *dt.MaxItems {
+			return fmt.Sprintf("%d items, expected at most %d", x, *dt.MaxItems)
+		}
+	case string:
+		if dt.DataType != DATATYPE_STRING && dt.DataType != DATATYPE_BINARY {
+			return ""
+		}
+		l := utf8.RuneCountInString(x)
+		if dt.MinLength != nil && l < *dt.MinLength {
+			return fmt.Sprintf("length %d is less than the minimum %d", l, *dt.MinLength)
+		}
+		if dt.MaxLength != nil && l > *dt.MaxLength {
+			return fmt.Sprintf("length %d is greater than the maximum %d", l, *dt.MaxLength)
+		}
+		if dt.Pattern != "" {
+			// compiled when parsing, types built by hand may lack it
+			re := dt.PatternRegexp
+			if re == nil {
+				re = regexp.MustCompile(dt.Pattern)
+			}
+			if !re.MatchString(x) {
+				return fmt.Sprintf("value '%s' does not match pattern /%s/", x, dt.Pattern)
+			}
+		}
+		if !validateFormat(dt.Format, x) {
+			return fmt.Sprintf("value '%s' is not a valid %s", x, dt.Format)
+		}
+	}
+	return ""
+}
+
+// validateFormat checks the known string formats, other formats are only documentation.
+func validateFormat(format string, value string) bool {
+	switch format {
+	case "email":
+		a, err := mail.ParseAddress(value)
+		return err == nil && a.Address == value
+	case "uuid":
+		return reValidateUUID.MatchString(value)
+	case "uri", "url":
+		u, err := url.Parse(value)
+		return err == nil && u.Scheme != "" && (u.Host != "" || u.Opaque != "")
+	case "ipv4":
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() != nil && !strings.Contains(value, ":")
+	case "ipv6":
+		ip := net.ParseIP(value)
+		return ip != nil && strings.Contains(value, ":")
+	}
+	return true
+}
+
+func (v *dataValidator) validateObject(dt *ApiDataType, o map[string]interface{}, location string, name string) ValidationErrors {
+	var ret ValidationErrors
+
+	for _, fn := range dt.ItemsOrder {
+		field := dt.Items[fn]
+		fv, ok := o[fn]
+		if !ok {
+			if field.Required {
+				ret = append(ret, &ValidationError{Location: location, Name: joinFieldName(name, fn), Message: "required field missing"})
+			}
+			continue
+		}
+		if fv == nil && field.Nullable {
+			continue
+		}
+		ret = append(ret, v.validateValue(field.ApiDataType, fv, location, joinFieldName(name, fn))...)
+	}
+
+	// objects without fields accept anything
+	if v.strict && len(dt.Items) > 0 {
+		unknown := make([]string, 0)
+		for fn := range o {
+			if _, ok := dt.Items[fn]; !ok {
+				unknown = append(unknown, fn)
+			}
+		}
+		sort.Strings(unknown)
+		for _, fn := range unknown {
+			ret = append(ret, &ValidationError{Location: location, Name: joinFieldName(name, fn), Message: "unknown field"})
+		}
+	}
+
+	return ret
+}
+
+// validateMap validates the keys and values of a map, in key order.
+func (v *dataValidator) validateMap(dt *ApiDataType, o map[string]interface{}, location string, name string) ValidationErrors {
+	keys := make([]string, 0, len(o))
+	for k := range o {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var ret ValidationErrors
+	for _, k := range keys {
+		fn := joinFieldName(name, k)
+		if dt.KeyDataType != nil {
+			if verrs := v.validateString(dt.KeyDataType, k, location, fn); len(verrs) > 0 {
+				ret = append(ret, &ValidationError{Location: location, Name: fn, Message: "invalid key: " + verrs[0].Message})
+				continue
+			}
+		}
+		if dt.ValueDataType != nil {
+			ret = append(ret, v.validateValue(dt.ValueDataType, o[k], location, fn)...)
+		}
+	}
+	return ret
+}
+
+func joinFieldName(parent string, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,105 @@
+package trapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+//
+// Validation of @apiExample payloads against their data types
+//
+
+type exampleValidation struct {
+	validator *dataValidator
+	checked   map[SPIB_Filename]bool
+	errors    []*ParserError
+}
+
+// ValidateExamples checks the JSON examples of defines, params and responses against their
+// data types, returning an error for each violation at the location of the example.
+func (p *Parser) ValidateExamples() []*ParserError {
+	ev := &exampleValidation{
+		validator: newDataValidator(p, true),
+		checked:   make(map[SPIB_Filename]bool),
+	}
+
+	for _, d := range p.ApiDefines {
+		if dt, ok := p.DataTypes[p.defineDataTypeKey(d.Name, d.Version)]; ok {
+			ev.validate(dt, dt.Examples, d.Name)
+		}
+		ev.validate(d.DataType, d.Examples, d.Name)
+	}
+
+	for _, api := range p.Apis {
+		owner := fmt.Sprintf("{%s} %s", api.Method, api.Path)
+
+		for _, pt := range []ParamType{PARAMTYPE_URI, PARAMTYPE_QUERY, PARAMTYPE_HEADER, PARAMTYPE_COOKIE, PARAMTYPE_FORM, PARAMTYPE_MULTIPART} {
+			pl, ok := api.Params[pt]
+			if !ok {
+				continue
+			}
+			for _, pn := range pl.Order {
+				param := pl.List[pn]
+				// file parts have no text value
+				if rdt := ev.validator.resolve(param.DataType); pt == PARAMTYPE_MULTIPART && rdt != nil && rdt.DataType == DATATYPE_BINARY {
+					continue
+				}
+				ev.validate(param.DataType, param.Examples, fmt.Sprintf("param %s of %s", pn, owner))
+			}
+		}
+
+		if api.Requests != nil {
+			for _, ct := range api.Requests.Order {
+				rb := api.Requests.List[ct]
+				bodyowner := fmt.Sprintf("body %s of %s", ct, owner)
+				if ct == "-" {
+					bodyowner = "body of " + owner
+				}
+				ev.validate(rb.ApiRequest.DataType, rb.ApiRequest.Examples, bodyowner)
+			}
+		}
+
+		if api.Responses != nil {
+			codes := make([]string, 0, len(api.Responses.List))
+			for code := range api.Responses.List {
+				codes = append(codes, code)
+			}
+			sort.Strings(codes)
+			for _, code := range codes {
+				for _, rb := range api.Responses.List[code] {
+					ev.validate(rb.ApiResponse.DataType, rb.ApiResponse.Examples, fmt.Sprintf("response %s of %s", code, owner))
+				}
+			}
+		}
+	}
+
+	return ev.errors
+}
+
+func (ev *exampleValidation) validate(dt *ApiDataType, examples []*ApiExample, owner string) {
+	if dt == nil {
+		return
+	}
+	for _, ex := range examples {
+		if !isJSONContentType(ex.ContentType) || ev.checked[ex.SPIB_Filename] {
+			continue
+		}
+		ev.checked[ex.SPIB_Filename] = true
+
+		var value interface{}
+		err := json.Unmarshal([]byte(ex.Text), &value)
+		if err != nil {
+			ev.errors = append(ev.errors, NewParserError(fmt.Sprintf("Example '%s' of %s is not valid JSON: %s", ex.Description, owner, err.Error()), ex.Filename, ex.Line))
+			continue
+		}
+
+		for _, verr := range ev.validator.validateValue(dt, value, "example", "") {
+			msg := verr.Message
+			if verr.Name != "" {
+				msg = verr.Name + ": " + msg
+			}
+			ev.errors = append(ev.errors, NewParserError(fmt.Sprintf("Example '%s' of %s does not match data type: %s", ex.Description, owner, msg), ex.Filename, ex.Line))
+		}
+	}
+}
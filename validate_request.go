@@ -0,0 +1,338 @@
+package trapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//
+// Request validation middleware
+//
+
+type RequestValidator struct {
+	parser    *Parser
+	matcher   *apiMatcher
+	validator *dataValidator
+
+	// maximum size in bytes of request bodies, 0 for no limit (default 10MB)
+	MaxBodySize int64
+}
+
+func NewRequestValidator(parser *Parser) *RequestValidator {
+	return &RequestValidator{
+		parser:      parser,
+		matcher:     newApiMatcher(parser.Apis),
+		validator:   newDataValidator(parser, false),
+		MaxBodySize: 10 << 20,
+	}
+}
+
+type requestValidationResponse struct {
+	Error      string           `json:"error"`
+	Violations ValidationErrors `json:"violations"`
+}
+
+// Handler returns a middleware that responds with 400 and the list of violations when
+// the request does not match its api documentation. Requests of undocumented apis are
+// passed through.
+func (v *RequestValidator) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, verrs := v.ValidateRequest(r)
+		if len(verrs) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(&requestValidationResponse{
+				Error:      "request validation failed",
+				Violations: verrs,
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ValidateRequest validates the request against the matching api, returning it or nil
+// if no api matches. The request body is preserved.
+func (v *RequestValidator) ValidateRequest(r *http.Request) (*Api, ValidationErrors) {
+	api, pathparams := v.matcher.match(r.Method, r.URL.Path)
+	if api == nil {
+		return nil, nil
+	}
+
+	var ret ValidationErrors
+
+	// uri params
+	if pl, ok := api.Params[PARAMTYPE_URI]; ok {
+		for _, pn := range pl.Order {
+			ret = append(ret, v.validator.validateString(pl.List[pn].DataType, pathparams[pn], "uri", pn)...)
+		}
+	}
+
+	// query params
+	if pl, ok := api.Params[PARAMTYPE_QUERY]; ok {
+		query := r.URL.Query()
+		for _, pn := range pl.Order {
+			ret = append(ret, v.validateValues(pl.List[pn], query[pn], "query")...)
+		}
+	}
+
+	// headers
+	if api.Headers != nil {
+		for _, hn := range api.Headers.Order {
+			hv := r.Header.Get(hn)
+			if hv == "" {
+				if api.Headers.List[hn][0].Required {
+					ret = append(ret, &ValidationError{Location: "header", Name: hn, Message: "required header missing"})
+				}
+				continue
+			}
+			ret = append(ret, v.validator.validateString(api.Headers.List[hn][0].DataType, hv, "header", hn)...)
+		}
+	}
+
+	// header params
+	if pl, ok := api.Params[PARAMTYPE_HEADER]; ok {
+		for _, pn := range pl.Order {
+			ret = append(ret, v.validateValues(pl.List[pn], r.Header[http.CanonicalHeaderKey(pn)], "header")...)
+		}
+	}
+
+	// cookie params
+	if pl, ok := api.Params[PARAMTYPE_COOKIE]; ok {
+		for _, pn := range pl.Order {
+			var values []string
+			if c, err := r.Cookie(pn); err == nil {
+				values = append(values, c.Value)
+			}
+			ret = append(ret, v.validateValues(pl.List[pn], values, "cookie")...)
+		}
+	}
+
+	// body
+	if api.Requests != nil && len(api.Requests.Order) > 0 {
+		ret = append(ret, v.validateBody(r, api.Requests)...)
+	}
+	if pl, ok := api.Params[PARAMTYPE_FORM]; ok {
+		ret = append(ret, v.validateForm(r, pl, false)...)
+	}
+	if pl, ok := api.Params[PARAMTYPE_MULTIPART]; ok {
+		ret = append(ret, v.validateForm(r, pl, true)...)
+	}
+
+	return api, ret
+}
+
+// validateValues validates the text values of a param, which may be missing. Arrays are
+// validated by the param style.
+func (v *RequestValidator) validateValues(param *ApiParam, values []string, location string) ValidationErrors {
+	if len(values) == 0 {
+		if param.Required {
+			return ValidationErrors{{Location: location, Name: param.Name, Message: "required param missing"}}
+		}
+		return nil
+	}
+	if rdt := v.validator.resolve(param.DataType); rdt != nil && rdt.DataType == DATATYPE_ARRAY {
+		switch param.Style {
+		case PARAMSTYLE_FORM:
+			return v.validator.validateStrings(param.DataType, values, location, param.Name)
+		case PARAMSTYLE_COMMA:
+			if len(values) > 1 {
+				return ValidationErrors{{Location: location, Name: param.Name, Message: "expected a single comma-delimited value"}}
+			}
+		}
+	}
+	var ret ValidationErrors
+	for _, value := range values {
+		ret = append(ret, v.validator.validateString(param.DataType, value, location, param.Name)...)
+	}
+	return ret
+}
+
+func (v *RequestValidator) readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	rd := r.Body
+	if v.MaxBodySize > 0 {
+		rd = http.MaxBytesReader(nil, r.Body, v.MaxBodySize)
+	}
+	body, err := ioutil.ReadAll(rd)
+	rd.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// validateForm validates urlencoded or multipart form params. Binary multipart params must
+// be file parts with one of the declared content types.
+func (v *RequestValidator) validateForm(r *http.Request, pl *ApiParamList, is_multipart bool) ValidationErrors {
+	location := "form"
+	expected := CONTENTTYPE_FORM
+	if is_multipart {
+		location = "multipart"
+		expected = CONTENTTYPE_MULTIPART
+	}
+
+	body, err := v.readBody(r)
+	if err != nil {
+		return ValidationErrors{{Location: location, Message: "error reading body: " + err.Error()}}
+	}
+
+	// without a body all params are missing
+	mt, mtparams, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if len(bytes.TrimSpace(body)) > 0 && (err != nil || mt != expected) {
+		return ValidationErrors{{Location: location, Message: "expected content type " + expected}}
+	}
+
+	values := make(url.Values)
+	files := make(map[string][]string)
+	if is_multipart && len(body) > 0 {
+		mr := multipart.NewReader(bytes.NewReader(body), mtparams["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return ValidationErrors{{Location: location, Message: "invalid multipart body: " + err.Error()}}
+			}
+			if part.FileName() != "" {
+				ct := part.Header.Get("Content-Type")
+				if ct == "" {
+					ct = "application/octet-stream"
+				}
+				files[part.FormName()] = append(files[part.FormName()], ct)
+			} else {
+				data, err := ioutil.ReadAll(part)
+				if err != nil {
+					return ValidationErrors{{Location: location, Message: "invalid multipart body: " + err.Error()}}
+				}
+				values.Add(part.FormName(), string(data))
+			}
+			part.Close()
+		}
+	} else if !is_multipart {
+		values, err = url.ParseQuery(string(body))
+		if err != nil {
+			return ValidationErrors{{Location: location, Message: "invalid form body: " + err.Error()}}
+		}
+	}
+
+	var ret ValidationErrors
+	for _, pn := range pl.Order {
+		param := pl.List[pn]
+		if rdt := v.validator.resolve(param.DataType); is_multipart && rdt != nil && rdt.DataType == DATATYPE_BINARY {
+			if len(files[pn]) == 0 {
+				if len(values[pn]) > 0 {
+					ret = append(ret, &ValidationError{Location: location, Name: pn, Message: "expected a file part"})
+				} else if param.Required {
+					ret = append(ret, &ValidationError{Location: location, Name: pn, Message: "required file missing"})
+				}
+				continue
+			}
+			if len(param.ContentTypes) > 0 {
+				for _, ct := range files[pn] {
+					if !matchMediaTypes(param.ContentTypes, ct) {
+						ret = append(ret, &ValidationError{Location: location, Name: pn, Message: fmt.Sprintf("file content type %s is not one of [%s]", ct, strings.Join(param.ContentTypes, ", "))})
+					}
+				}
+			}
+			continue
+		}
+		ret = append(ret, v.validateValues(param, values[pn], location)...)
+	}
+	return ret
+}
+
+// matchMediaTypes returns whether the content type matches any of the media types, which
+// may be wildcards like image/*.
+func matchMediaTypes(mediatypes []string, contenttype string) bool {
+	for _, m := range mediatypes {
+		m = strings.ToLower(strings.TrimSpace(m))
+		if m == "*/*" || sameMediaType(m, contenttype) {
+			return true
+		}
+		if strings.HasSuffix(m, "/*") {
+			if mt, _, err := mime.ParseMediaType(contenttype); err == nil && strings.HasPrefix(mt, strings.TrimSuffix(m, "*")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (v *RequestValidator) validateBody(r *http.Request, rl *ApiRequestList) ValidationErrors {
+	body, err := v.readBody(r)
+	if err != nil {
+		return ValidationErrors{{Location: "body", Message: "error reading body: " + err.Error()}}
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		for _, ct := range rl.Order {
+			if rl.List[ct].ApiRequest.Required {
+				return ValidationErrors{{Location: "body", Message: "required body missing"}}
+			}
+		}
+		return nil
+	}
+
+	// select the body by content type, "-" accepts any
+	ct := r.Header.Get("Content-Type")
+	var req *ApiRequest
+	for _, rct := range rl.Order {
+		if rct == "-" || (ct != "" && matchMediaTypes([]string{rct}, ct)) {
+			req = rl.List[rct].ApiRequest
+			break
+		}
+	}
+	if req == nil {
+		if ct == "" {
+			return ValidationErrors{{Location: "body", Message: fmt.Sprintf("content type missing, expected one of [%s]", strings.Join(rl.Order, ", "))}}
+		}
+		return ValidationErrors{{Location: "body", Message: fmt.Sprintf("content type %s is not one of [%s]", ct, strings.Join(rl.Order, ", "))}}
+	}
+
+	// only JSON bodies are validated
+	if ct != "" && !isJSONContentType(ct) {
+		return nil
+	}
+
+	var value interface{}
+	err = json.Unmarshal(body, &value)
+	if err != nil {
+		return ValidationErrors{{Location: "body", Message: "invalid JSON: " + err.Error()}}
+	}
+
+	return v.validator.validateValue(req.DataType, value, "body", "")
+}
+
+// jsonRequest returns the request body accepting JSON, or nil if there is none.
+func jsonRequest(rl *ApiRequestList) *ApiRequest {
+	if rl == nil {
+		return nil
+	}
+	for _, ct := range rl.Order {
+		if ct == "-" || isJSONContentType(ct) {
+			return rl.List[ct].ApiRequest
+		}
+	}
+	return nil
+}
+
+func isJSONContentType(contenttype string) bool {
+	contenttype = strings.ToLower(strings.TrimSpace(contenttype))
+	if mt, _, err := mime.ParseMediaType(contenttype); err == nil {
+		contenttype = mt
+	}
+	return contenttype == "application/json" || contenttype == "json" || strings.HasSuffix(contenttype, "+json")
+}
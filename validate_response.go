@@ -0,0 +1,206 @@
+package trapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//
+// Response validation middleware
+//
+
+type ResponseValidationMode int
+
+const (
+	// log violations and send the original response
+	RESPONSEVALIDATION_LOG ResponseValidationMode = iota
+	// replace the response with a 500 error listing the violations
+	RESPONSEVALIDATION_FAIL
+)
+
+func (m ResponseValidationMode) String() string {
+	switch m {
+	case RESPONSEVALIDATION_LOG:
+		return "RESPONSEVALIDATION_LOG"
+	case RESPONSEVALIDATION_FAIL:
+		return "RESPONSEVALIDATION_FAIL"
+	}
+	return "RESPONSEVALIDATION_UNKNOWN"
+}
+
+type ResponseValidator struct {
+	parser    *Parser
+	matcher   *apiMatcher
+	validator *dataValidator
+
+	Mode ResponseValidationMode
+	// called with the violations of each response, defaults to the standard logger
+	Logger func(api *Api, r *http.Request, status int, verrs ValidationErrors)
+}
+
+func NewResponseValidator(parser *Parser, mode ResponseValidationMode) *ResponseValidator {
+	return &ResponseValidator{
+		parser:    parser,
+		matcher:   newApiMatcher(parser.Apis),
+		validator: newDataValidator(parser, false),
+		Mode:      mode,
+	}
+}
+
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+type responseValidationResponse struct {
+	Error      string           `json:"error"`
+	Status     int              `json:"status"`
+	Violations ValidationErrors `json:"violations"`
+}
+
+// Handler returns a middleware that buffers the response of documented apis and checks it
+// against the documentation.
+func (v *ResponseValidator) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api, _ := v.matcher.match(r.Method, r.URL.Path)
+		if api == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &responseRecorder{
+			header: make(http.Header),
+		}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		verrs := v.ValidateResponse(api, rec.status, rec.header, rec.body.Bytes())
+		if len(verrs) > 0 {
+			v.log(api, r, rec.status, verrs)
+
+			if v.Mode == RESPONSEVALIDATION_FAIL {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(&responseValidationResponse{
+					Error:      "response validation failed",
+					Status:     rec.status,
+					Violations: verrs,
+				})
+				return
+			}
+		}
+
+		for hn, hv := range rec.header {
+			w.Header()[hn] = hv
+		}
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+	})
+}
+
+func (v *ResponseValidator) log(api *Api, r *http.Request, status int, verrs ValidationErrors) {
+	if v.Logger != nil {
+		v.Logger(api, r, status, verrs)
+		return
+	}
+	log.Printf("Response of {%s} %s [%s:%d] with status %d does not match documentation: %s", api.Method, api.Path, api.Filename, api.Line, status, verrs.Error())
+}
+
+// ValidateResponse checks the status code, content type, headers and JSON body of a response.
+func (v *ResponseValidator) ValidateResponse(api *Api, status int, header http.Header, body []byte) ValidationErrors {
+	code := strconv.Itoa(status)
+
+	var bodies []*ApiResponseBody
+	if api.Responses != nil {
+		bodies = api.Responses.List[code]
+	}
+	if len(bodies) == 0 {
+		return ValidationErrors{{Location: "status", Name: code, Message: "status code not documented"}}
+	}
+
+	// find the response by content type
+	contenttype := header.Get("Content-Type")
+	var resp *ApiResponse
+	var declared []string
+	for _, rb := range bodies {
+		if rb.ContentType == "" || rb.ContentType == "-" || sameMediaType(rb.ContentType, contenttype) {
+			resp = rb.ApiResponse
+			break
+		}
+		declared = append(declared, rb.ContentType)
+	}
+	if resp == nil {
+		if len(bytes.TrimSpace(body)) == 0 {
+			resp = bodies[0].ApiResponse
+		} else {
+			return ValidationErrors{{Location: "header", Name: "Content-Type", Message: fmt.Sprintf("content type '%s' not documented, expected one of [%s]", contenttype, strings.Join(declared, ","))}}
+		}
+	}
+
+	var ret ValidationErrors
+
+	// headers
+	if resp.Headers != nil {
+		for _, hn := range resp.Headers.Order {
+			hv := header.Get(hn)
+			if hv == "" {
+				if resp.Headers.List[hn][0].Required {
+					ret = append(ret, &ValidationError{Location: "header", Name: hn, Message: "documented header missing"})
+				}
+				continue
+			}
+			ret = append(ret, v.validator.validateString(resp.Headers.List[hn][0].DataType, hv, "header", hn)...)
+		}
+	}
+
+	// only JSON bodies are validated
+	if len(bytes.TrimSpace(body)) > 0 && isJSONContentType(contenttype) && resp.DataType != nil {
+		var value interface{}
+		err := json.Unmarshal(body, &value)
+		if err != nil {
+			ret = append(ret, &ValidationError{Location: "body", Message: "invalid JSON: " + err.Error()})
+		} else {
+			ret = append(ret, v.validator.validateValue(resp.DataType, value, "body", "")...)
+		}
+	}
+
+	return ret
+}
+
+func sameMediaType(a string, b string) bool {
+	ma, _, err := mime.ParseMediaType(a)
+	if err != nil {
+		ma = strings.ToLower(strings.TrimSpace(a))
+	}
+	mb, _, err := mime.ParseMediaType(b)
+	if err != nil {
+		mb = strings.ToLower(strings.TrimSpace(b))
+	}
+	return ma == mb
+}
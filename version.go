@@ -0,0 +1,271 @@
+package trapi
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//
+// Versions: filtered views of the apis declared with @apiVersion
+//
+
+// CompareVersions compares dotted versions numerically ("1.10" > "1.9"), returning -1, 0 or 1.
+// An empty version is lower than any other.
+func CompareVersions(a string, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	if a == "" || b == "" {
+		as, bs = []string{a}, []string{b}
+	}
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var ap, bp string
+		if i < len(as) {
+			ap = as[i]
+		}
+		if i < len(bs) {
+			bp = bs[i]
+		}
+		ai, aerr := strconv.Atoi(ap)
+		bi, berr := strconv.Atoi(bp)
+		if aerr == nil && berr == nil {
+			if ai != bi {
+				if ai < bi {
+					return -1
+				}
+				return 1
+			}
+			continue
+		}
+		if c := strings.Compare(ap, bp); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// selectVersions returns the indexes of the versions visible in the [min,max] range: the
+// versions inside it and the one in effect at min. Empty limits are open.
+func selectVersions(versions []string, min string, max string) []int {
+	var candidates []int
+	for i, v := range versions {
+		if max == "" || CompareVersions(v, max) <= 0 {
+			candidates = append(candidates, i)
+		}
+	}
+	if min == "" {
+		return candidates
+	}
+
+	// highest version not above min
+	effective := ""
+	found := false
+	for _, i := range candidates {
+		if CompareVersions(versions[i], min) <= 0 && (!found || CompareVersions(versions[i], effective) > 0) {
+			effective = versions[i]
+			found = true
+		}
+	}
+
+	var ret []int
+	for _, i := range candidates {
+		if !found || CompareVersions(versions[i], effective) >= 0 {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
+
+// filterVersions returns a copy of the parsed items visible in the version range. All the
+// visible versions of each define are kept, each api references the ones in effect at its
+// version.
+func (sp *SourceParser) filterVersions(min string, max string) *SourceParser {
+	ret := &SourceParser{
+		gcp:             sp.gcp,
+		tags:            sp.tags,
+		Routes:          sp.Routes,
+		RouteMismatches: sp.RouteMismatches,
+		SecuritySchemes: sp.SecuritySchemes,
+	}
+
+	// apis by method and path
+	apigroups := make(map[string][]int)
+	var apiorder []string
+	for i, a := range sp.Apis {
+		key := strings.ToLower(a.Method) + " " + a.Path
+		if _, ok := apigroups[key]; !ok {
+			apiorder = append(apiorder, key)
+		}
+		apigroups[key] = append(apigroups[key], i)
+	}
+	keep := make(map[int]bool)
+	for _, key := range apiorder {
+		versions := make([]string, 0)
+		for _, i := range apigroups[key] {
+			versions = append(versions, sp.Apis[i].Version)
+		}
+		for _, vi := range selectVersions(versions, min, max) {
+			keep[apigroups[key][vi]] = true
+		}
+	}
+	for i, a := range sp.Apis {
+		if keep[i] {
+			ret.Apis = append(ret.Apis, a)
+		}
+	}
+
+	// defines by name
+	defgroups := make(map[string][]int)
+	for i, d := range sp.Defines {
+		defgroups[d.Name] = append(defgroups[d.Name], i)
+	}
+	keep = make(map[int]bool)
+	for _, group := range defgroups {
+		versions := make([]string, 0)
+		for _, i := range group {
+			versions = append(versions, sp.Defines[i].Version)
+		}
+		for _, vi := range selectVersions(versions, min, max) {
+			keep[group[vi]] = true
+		}
+	}
+	for i, d := range sp.Defines {
+		if keep[i] {
+			ret.Defines = append(ret.Defines, d)
+		}
+	}
+
+	return ret
+}
+
+// defineVersions returns the versions of the defines declared in more than one version, in
+// order.
+func (sp *SourceParser) defineVersions() map[string][]string {
+	ret := make(map[string][]string)
+	for _, d := range sp.Defines {
+		found := false
+		for _, v := range ret[d.Name] {
+			if CompareVersions(v, d.Version) == 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ret[d.Name] = append(ret[d.Name], d.Version)
+		}
+	}
+	for name, versions := range ret {
+		if len(versions) < 2 {
+			delete(ret, name)
+			continue
+		}
+		sort.Slice(versions, func(i, j int) bool {
+			return CompareVersions(versions[i], versions[j]) < 0
+		})
+	}
+	return ret
+}
+
+// versionedDataTypeName returns the name of the data type of a define version that is not the
+// highest one in the view, which keeps the define name.
+func versionedDataTypeName(name string, version string) string {
+	return name + "@" + version
+}
+
+// defineDataTypeKey returns the key in DataTypes of the define version.
+func (p *Parser) defineDataTypeKey(name string, version string) string {
+	versions := p.defineversions[name]
+	if len(versions) == 0 || CompareVersions(version, versions[len(versions)-1]) == 0 {
+		return name
+	}
+	return versionedDataTypeName(name, version)
+}
+
+// dataTypeKey returns the key in DataTypes of the data type referenced by an item of the
+// version: the highest define version not above it. Items without version reference the
+// highest one.
+func (p *Parser) dataTypeKey(name string, version string) string {
+	versions := p.defineversions[name]
+	if len(versions) == 0 || version == "" {
+		return name
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		if CompareVersions(versions[i], version) <= 0 {
+			return p.defineDataTypeKey(name, versions[i])
+		}
+	}
+	return name
+}
+
+// Versions returns all versions declared with @apiVersion, in order.
+func (p *Parser) Versions() []string {
+	if p.source == nil {
+		return nil
+	}
+	found := make(map[string]bool)
+	for _, a := range p.source.Apis {
+		if a.Version != "" {
+			found[a.Version] = true
+		}
+	}
+	for _, d := range p.source.Defines {
+		if d.Version != "" {
+			found[d.Version] = true
+		}
+	}
+	ret := make([]string, 0, len(found))
+	for v := range found {
+		ret = append(ret, v)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return CompareVersions(ret[i], ret[j]) < 0
+	})
+	return ret
+}
+
+// ForVersion returns a parser with the apis and defines in effect at the version: for each
+// path or define, the highest declared version not above it. Items without version are
+// always included.
+func (p *Parser) ForVersion(version string) (*Parser, error) {
+	return p.ForVersionRange(version, version)
+}
+
+// ForVersionRange returns a parser with all api versions in the range, including the ones in
+// effect at min. Empty limits are open.
+func (p *Parser) ForVersionRange(min string, max string) (*Parser, error) {
+	if p.source == nil {
+		return nil, fmt.Errorf("Parser has no parsed source")
+	}
+	ret := NewParser(p.gcp)
+	ret.files = p.files
+	ret.dirs = p.dirs
+	ret.tags = p.tags
+	ret.analyzeroutes = p.analyzeroutes
+
+	err := ret.parseSourceVersion(p.source, min, max)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GenerateVersions runs the generator once for each declared version.
+func GenerateVersions(parser *Parser, g Generator, out func(version string) (io.Writer, error)) error {
+	for _, v := range parser.Versions() {
+		vp, err := parser.ForVersion(v)
+		if err != nil {
+			return err
+		}
+		w, err := out(v)
+		if err != nil {
+			return err
+		}
+		err = g.Generate(vp, w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}